@@ -0,0 +1,88 @@
+package configstore
+
+import (
+	"fmt"
+)
+
+// AmbiguityPolicy defines how GetItem resolves several items sharing the same key.
+// See Store.SetAmbiguityPolicy and ItemFilter.ResolveAmbiguity.
+type AmbiguityPolicy int
+
+const (
+	// AmbiguityStrict returns ErrAmbiguousItem as soon as several items share the key. This is the default.
+	AmbiguityStrict AmbiguityPolicy = iota
+	// AmbiguityHighestPriority returns the item with the highest priority.
+	// Among items sharing the highest priority, the first one in merge order wins.
+	AmbiguityHighestPriority
+	// AmbiguityHighestPriorityStrict returns the item with the highest priority,
+	// but returns ErrAmbiguousItem if several items share the highest priority.
+	AmbiguityHighestPriorityStrict
+	// AmbiguityLastProvider returns the item of the provider merged last (see Rank), regardless of priorities.
+	// If that provider returned several items for the key, the one with the highest priority wins.
+	// For item lists which were not built by a store, this is equivalent to AmbiguityHighestPriority.
+	AmbiguityLastProvider
+)
+
+var ambiguityPolicyNames = map[AmbiguityPolicy]string{
+	AmbiguityStrict:                "strict",
+	AmbiguityHighestPriority:       "highest-priority",
+	AmbiguityHighestPriorityStrict: "highest-priority-strict",
+	AmbiguityLastProvider:          "last-provider",
+}
+
+// String returns the policy name.
+func (p AmbiguityPolicy) String() string {
+	if name, ok := ambiguityPolicyNames[p]; ok {
+		return name
+	}
+	return fmt.Sprintf("policy(%d)", int(p))
+}
+
+// resolve picks a single item among items sharing key, which are sorted by priority.
+func (p AmbiguityPolicy) resolve(key string, items []Item) (Item, error) {
+	switch len(items) {
+	case 0:
+		return Item{}, ErrItemNotFound{Key: key}
+	case 1:
+		return items[0], nil
+	}
+
+	switch p {
+	case AmbiguityHighestPriority:
+		return items[0], nil
+	case AmbiguityHighestPriorityStrict:
+		if items[1].priority < items[0].priority {
+			return items[0], nil
+		}
+		top := 0
+		for top < len(items) && items[top].priority == items[0].priority {
+			top++
+		}
+		return Item{}, &ErrAmbiguousItem{Key: key, Candidates: items[:top], topPriority: true}
+	case AmbiguityLastProvider:
+		ret := items[0]
+		for _, it := range items[1:] {
+			if it.origin > ret.origin {
+				ret = it
+			}
+		}
+		return ret, nil
+	}
+	return Item{}, &ErrAmbiguousItem{Key: key, Candidates: items}
+}
+
+// SetAmbiguityPolicy sets the policy used by GetItem (and the GetItemValue variants) to resolve several items
+// sharing the same key, on the item lists returned by the store. The default is AmbiguityStrict.
+func (s *Store) SetAmbiguityPolicy(p AmbiguityPolicy) {
+	s.pMut.Lock()
+	defer s.pMut.Unlock()
+	s.ambiguityPolicy = p
+}
+
+// ResolveAmbiguity sets the policy used by GetItem to resolve several items sharing the same key,
+// overriding the store policy. See AmbiguityPolicy.
+func (s *ItemFilter) ResolveAmbiguity(p AmbiguityPolicy) *ItemFilter {
+	s = copyItemFilter(s)
+	s.ambiguityPolicy = &p
+	return s
+}
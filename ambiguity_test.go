@@ -0,0 +1,86 @@
+package configstore
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAmbiguityPolicies(t *testing.T) {
+	s := NewStore()
+	defer s.Close()
+	s.InMemory("high").Add(NewItem("foo", "high", 10), NewItem("tie", "high", 5))
+	s.InMemory("low").Add(NewItem("foo", "low", 1), NewItem("tie", "low", 5))
+	s.InMemory("single").Add(NewItem("bar", "single", 0))
+
+	tests := []struct {
+		policy  AmbiguityPolicy
+		foo     string
+		tie     string
+		tieFail bool
+	}{
+		{policy: AmbiguityStrict, tieFail: true},
+		{policy: AmbiguityHighestPriority, foo: "high", tie: "high"},
+		{policy: AmbiguityHighestPriorityStrict, foo: "high", tieFail: true},
+		{policy: AmbiguityLastProvider, foo: "low", tie: "low"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.policy.String(), func(t *testing.T) {
+			s.SetAmbiguityPolicy(tt.policy)
+
+			v, err := s.GetItemValue("bar")
+			require.NoError(t, err)
+			assert.Equal(t, "single", v)
+
+			_, err = s.GetItem("missing")
+			assert.IsType(t, ErrItemNotFound{}, err)
+
+			i, err := s.GetItem("foo")
+			if tt.foo == "" {
+				assert.IsType(t, &ErrAmbiguousItem{}, err)
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, tt.foo, i.value)
+				assert.Equal(t, tt.foo, i.Provider())
+			}
+
+			i, err = s.GetItem("tie")
+			if tt.tieFail {
+				assert.IsType(t, &ErrAmbiguousItem{}, err)
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, tt.tie, i.value)
+			}
+		})
+	}
+}
+
+func TestAmbiguityPolicyFilter(t *testing.T) {
+	s := NewStore()
+	defer s.Close()
+	s.InMemory("high").Add(NewItem("foo", "high", 10))
+	s.InMemory("low").Add(NewItem("foo", "low", 1))
+
+	_, err := Filter().Store(s).GetItem("foo")
+	assert.IsType(t, &ErrAmbiguousItem{}, err)
+
+	f := Filter().Store(s).ResolveAmbiguity(AmbiguityHighestPriority)
+	v, err := f.GetItemValue("foo")
+	require.NoError(t, err)
+	assert.Equal(t, "high", v)
+
+	// the policy survives further filtering steps
+	v, err = f.Slice("foo").GetItemValue("foo")
+	require.NoError(t, err)
+	assert.Equal(t, "high", v)
+
+	// the filter policy overrides the store policy
+	s.SetAmbiguityPolicy(AmbiguityHighestPriority)
+	_, err = Filter().Store(s).ResolveAmbiguity(AmbiguityStrict).GetItem("foo")
+	assert.IsType(t, &ErrAmbiguousItem{}, err)
+	v, err = Filter().Store(s).GetItemValue("foo")
+	require.NoError(t, err)
+	assert.Equal(t, "high", v)
+}
@@ -0,0 +1,122 @@
+package configstore
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// cachedProvider serves the items of a provider from memory, and refreshes them in the background
+// once they are older than the cache TTL (stale-while-revalidate).
+type cachedProvider struct {
+	s      *Store
+	p      Provider
+	reload func(context.Context) error
+	ttl    time.Duration
+
+	mut        sync.Mutex
+	items      []Item
+	hash       [sha256.Size]byte
+	loaded     time.Time
+	valid      bool
+	refreshing bool
+}
+
+func newCachedProvider(s *Store, p Provider, reload func(context.Context) error, ttl time.Duration) *cachedProvider {
+	return &cachedProvider{s: s, p: p, reload: reload, ttl: ttl}
+}
+
+// CachedProvider wraps an expensive provider (remote API, database, ...), so that it is not called on every GetItemList.
+// The items are kept in memory for ttl. Past that delay, they are still served while they get refreshed in the background,
+// and the watchers are notified if the refreshed items differ. If a refresh fails, the error is logged and the previous
+// items are kept. The provider is only called synchronously when there are no items to serve yet.
+//
+// The Cache option wraps a registered provider the same way, e.g. s.RegisterProvider(name, f, Cache(time.Minute)).
+func (s *Store) CachedProvider(p Provider, ttl time.Duration) Provider {
+	return newCachedProvider(s, p, nil, ttl).Items
+}
+
+// Cache wraps the provider with a cache, see Store.CachedProvider.
+func Cache(ttl time.Duration) ProviderOption {
+	return func(o *providerOptions) {
+		o.cache = ttl
+	}
+}
+
+// Items returns the cached items, and schedules a refresh if they are stale.
+func (c *cachedProvider) Items() (ItemList, error) {
+	c.mut.Lock()
+	if c.valid {
+		if time.Since(c.loaded) >= c.ttl && !c.refreshing && c.s.ctx.Err() == nil {
+			c.refreshing = true
+			go c.refresh()
+		}
+		items := c.items
+		c.mut.Unlock()
+		return ItemList{Items: items}, nil
+	}
+	c.mut.Unlock()
+
+	// nothing to serve yet, load synchronously, without blocking the other callers and Reload
+	items, err := c.p()
+	if err != nil {
+		return ItemList{}, err
+	}
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	if !c.valid {
+		c.setLocked(items.Items)
+	}
+	return ItemList{Items: c.items}, nil
+}
+
+// refresh reloads the items in the background, and notifies the watchers if they changed.
+func (c *cachedProvider) refresh() {
+	items, err := c.p()
+
+	c.mut.Lock()
+	c.refreshing = false
+	if err != nil {
+		// keep serving the previous items, and retry once they are stale again
+		c.loaded = time.Now()
+		c.mut.Unlock()
+		logError(fmt.Errorf("configstore: cache refresh: %w", err))
+		return
+	}
+	changed := c.setLocked(items.Items)
+	c.mut.Unlock()
+
+	if changed {
+		c.s.NotifyWatchers()
+	}
+}
+
+// Reload refreshes the items synchronously, without notifying the watchers. It implements Reloadable.
+func (c *cachedProvider) Reload(ctx context.Context) error {
+	if c.reload != nil {
+		if err := c.reload(ctx); err != nil {
+			return err
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	items, err := c.p()
+	if err != nil {
+		return err
+	}
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	c.setLocked(items.Items)
+	return nil
+}
+
+// setLocked replaces the cached items, and reports whether they changed. It must be called with mut held.
+func (c *cachedProvider) setLocked(items []Item) bool {
+	h := hashItems(items)
+	changed := !c.valid || h != c.hash
+	c.items, c.hash, c.loaded, c.valid = items, h, time.Now(), true
+	return changed
+}
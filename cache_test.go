@@ -0,0 +1,154 @@
+package configstore
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ovh/configstore/internal/storetest"
+)
+
+func TestCachedProvider(t *testing.T) {
+	s := NewStore()
+	defer s.Close()
+
+	var calls int32
+	var value atomic.Value
+	value.Store("v1")
+	var fail atomic.Bool
+	ch := s.Watch()
+	s.RegisterProvider("remote", s.CachedProvider(func() (ItemList, error) {
+		atomic.AddInt32(&calls, 1)
+		if fail.Load() {
+			return ItemList{}, errors.New("unreachable")
+		}
+		return ItemList{Items: []Item{NewItem("foo", value.Load().(string), 0)}}, nil
+	}, 50*time.Millisecond))
+	<-ch
+
+	for i := 0; i < 5; i++ {
+		v, err := s.GetItemValue("foo")
+		require.NoError(t, err)
+		assert.Equal(t, "v1", v)
+	}
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+
+	// stale items are served while they get refreshed, watchers are notified of the change
+	value.Store("v2")
+	time.Sleep(60 * time.Millisecond)
+	v, err := s.GetItemValue("foo")
+	require.NoError(t, err)
+	assert.Equal(t, "v1", v)
+	storetest.WaitNotification(t, ch)
+	v, err = s.GetItemValue("foo")
+	require.NoError(t, err)
+	assert.Equal(t, "v2", v)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+
+	// refresh failures keep the previous items
+	fail.Store(true)
+	time.Sleep(60 * time.Millisecond)
+	_, err = s.GetItemValue("foo")
+	require.NoError(t, err)
+	require.Eventually(t, func() bool { return atomic.LoadInt32(&calls) == 3 }, 5*time.Second, 10*time.Millisecond)
+	v, err = s.GetItemValue("foo")
+	require.NoError(t, err)
+	assert.Equal(t, "v2", v)
+}
+
+func TestCacheOption(t *testing.T) {
+	s := NewStore()
+	defer s.Close()
+
+	var calls int32
+	s.RegisterProvider("remote", func() (ItemList, error) {
+		n := atomic.AddInt32(&calls, 1)
+		if n == 1 {
+			return ItemList{}, errors.New("not yet")
+		}
+		return ItemList{Items: []Item{NewItem("foo", "bar", 0)}}, nil
+	}, Cache(time.Hour))
+
+	// nothing to serve yet: errors are returned, and the next read retries
+	_, err := s.GetItemList()
+	require.Error(t, err)
+	for i := 0; i < 3; i++ {
+		_, err = s.GetItemList()
+		require.NoError(t, err)
+	}
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+
+	// Reload bypasses the cache
+	require.NoError(t, s.Reload(s.ctx))
+	assert.Equal(t, int32(3), atomic.LoadInt32(&calls))
+}
+
+func TestCachedProviderFirstLoad(t *testing.T) {
+	s := NewStore()
+	defer s.Close()
+
+	// the first load does not hold the lock: concurrent callers are not serialized behind it
+	var calls int32
+	both := make(chan struct{})
+	p := s.CachedProvider(func() (ItemList, error) {
+		if atomic.AddInt32(&calls, 1) == 2 {
+			close(both)
+		}
+		select {
+		case <-both:
+		case <-time.After(5 * time.Second):
+			return ItemList{}, errors.New("the first loads are serialized")
+		}
+		return ItemList{Items: []Item{NewItem("foo", "bar", 0)}}, nil
+	}, time.Hour)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			l, err := p()
+			assert.NoError(t, err)
+			assert.Len(t, l.Items, 1)
+		}()
+	}
+	wg.Wait()
+}
+
+var cacheTestCalls int32
+
+func init() {
+	RegisterProviderFactoryInfo(ProviderFactoryInfo{
+		Name: "cachetest",
+		Factory: func(s *Store, spec ProviderSpec) error {
+			s.RegisterProvider("cachetest:"+spec.Arg, func() (ItemList, error) {
+				atomic.AddInt32(&cacheTestCalls, 1)
+				return ItemList{Items: []Item{NewItem("foo", spec.Arg, 0)}}, nil
+			}, spec.ProviderOptions()...)
+			return nil
+		},
+	})
+}
+
+func TestCacheFromEnvironment(t *testing.T) {
+	atomic.StoreInt32(&cacheTestCalls, 0)
+
+	t.Setenv(ConfigEnvVar, "cachetest:bar?cache=1h")
+	s := NewStore()
+	defer s.Close()
+	require.NoError(t, s.InitFromEnvironment())
+	for i := 0; i < 3; i++ {
+		v, err := s.GetItemValue("foo")
+		require.NoError(t, err)
+		assert.Equal(t, "bar", v)
+	}
+	assert.Equal(t, int32(1), atomic.LoadInt32(&cacheTestCalls))
+
+	t.Setenv(ConfigEnvVar, "cachetest:bar?cache=soon")
+	assert.Error(t, NewStore().InitFromEnvironment())
+}
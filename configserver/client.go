@@ -0,0 +1,153 @@
+package configserver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ovh/configstore"
+)
+
+func init() {
+	configstore.RegisterProviderFactoryInfo(configstore.ProviderFactoryInfo{
+		Name:        "configserver",
+		Description: "Reads items from a configserver, and follows its changes.",
+		Syntax:      "configserver:<url>",
+		Examples:    []string{"configserver:http://config.internal:8080?max-wait=1m"},
+		Options:     []string{"max-wait", "retry-delay"},
+		Factory:     factory,
+	})
+}
+
+// DefaultRetryDelay is the default delay between two watch requests, after a failure.
+const DefaultRetryDelay = time.Second
+
+// ClientConfig configures the client provider, see Register.
+type ClientConfig struct {
+	// HTTPClient is the client used for the requests (http.DefaultClient by default). Its timeout, if any,
+	// must be longer than MaxWait.
+	HTTPClient *http.Client
+	// MaxWait is the duration of the watch requests (DefaultMaxWait by default). The server may cap it.
+	MaxWait time.Duration
+	// RetryDelay is the delay before the next watch request after a failure (DefaultRetryDelay by default).
+	RetryDelay time.Duration
+}
+
+func factory(s *configstore.Store, spec configstore.ProviderSpec) error {
+	var cfg ClientConfig
+	var err error
+	cfg.MaxWait, err = spec.DurationOption("max-wait", 0)
+	if err == nil {
+		cfg.RetryDelay, err = spec.DurationOption("retry-delay", 0)
+	}
+	if err != nil {
+		s.ErrorProvider("configserver:"+spec.Arg, err)
+		return err
+	}
+	return Register(s, spec.Arg, cfg, spec.ProviderOptions()...)
+}
+
+// client keeps a local copy of the items exposed by a server.
+type client struct {
+	*configstore.Remote
+	baseURL string
+	cfg     ClientConfig
+
+	// only used by the goroutine following the server
+	revision uint64
+}
+
+// Register registers a provider reading the items exposed by the server at baseURL, named "configserver:<baseURL>".
+// The items are kept in memory, and updated as soon as the server pushes a new revision: watchers get notified.
+// The provider stops following the server when the store is closed (see configstore.Remote for the handling of failures).
+func Register(s *configstore.Store, baseURL string, cfg ClientConfig, opts ...configstore.ProviderOption) error {
+	if cfg.HTTPClient == nil {
+		cfg.HTTPClient = http.DefaultClient
+	}
+	if cfg.MaxWait <= 0 {
+		cfg.MaxWait = DefaultMaxWait
+	}
+	if cfg.RetryDelay <= 0 {
+		cfg.RetryDelay = DefaultRetryDelay
+	}
+	c := &client{Remote: s.NewRemote("configserver:" + baseURL), baseURL: strings.TrimSuffix(baseURL, "/"), cfg: cfg}
+
+	snapshot, err := c.fetch(c.Context(), "/snapshot")
+	if err == nil {
+		c.revision = snapshot.Revision
+		c.Set(snapshot.items()...)
+	}
+	err = c.Register(err, true, opts...)
+	go c.follow(c.Context())
+	return err
+}
+
+// items returns the snapshot items.
+func (snapshot *Snapshot) items() []configstore.Item {
+	items := make([]configstore.Item, len(snapshot.Items))
+	for i, it := range snapshot.Items {
+		items[i] = configstore.NewItem(it.Key, it.Value, it.Priority).WithSensitive(it.Sensitive)
+	}
+	return items
+}
+
+// follow long-polls the server for new revisions, until ctx is done.
+func (c *client) follow(ctx context.Context) {
+	for ctx.Err() == nil {
+		query := url.Values{
+			"revision": {strconv.FormatUint(c.revision, 10)},
+			"timeout":  {c.cfg.MaxWait.String()},
+		}
+		snapshot, err := c.fetch(ctx, "/watch?"+query.Encode())
+		switch {
+		case ctx.Err() != nil:
+			return
+		case err != nil:
+			c.Fail(err)
+			// the next request returns the current items right away, so that the provider recovers
+			c.revision = 0
+			select {
+			case <-ctx.Done():
+			case <-time.After(c.cfg.RetryDelay):
+			}
+		case snapshot != nil:
+			c.revision = snapshot.Revision
+			c.Update(snapshot.items()...)
+		}
+	}
+}
+
+// fetch requests an endpoint of the server. It returns a nil snapshot if the server answered Not Modified.
+func (c *client) fetch(ctx context.Context, endpoint string) (*Snapshot, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.cfg.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotModified:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("configserver: %s: unexpected status: %s", c.baseURL, resp.Status)
+	}
+	var snapshot Snapshot
+	if err := json.NewDecoder(resp.Body).Decode(&snapshot); err != nil {
+		return nil, fmt.Errorf("configserver: %s: %w", c.baseURL, err)
+	}
+	if snapshot.Revision == 0 {
+		return nil, errors.New("configserver: " + c.baseURL + ": invalid snapshot")
+	}
+	return &snapshot, nil
+}
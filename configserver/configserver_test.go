@@ -0,0 +1,177 @@
+package configserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ovh/configstore"
+	"github.com/ovh/configstore/internal/storetest"
+)
+
+func TestServerAndClient(t *testing.T) {
+	upstream := configstore.NewStore()
+	defer upstream.Close()
+	inmem := upstream.InMemory("upstream")
+	inmem.Add(configstore.NewItem("foo", "bar", 5))
+
+	srv := NewServer(upstream, ServerConfig{})
+	defer srv.Close()
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	s := configstore.NewStore()
+	defer s.Close()
+	ch := s.Watch()
+	require.NoError(t, Register(s, ts.URL, ClientConfig{MaxWait: time.Second}))
+	storetest.WaitNotification(t, ch)
+
+	i, err := s.GetItem("foo")
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), i.Priority())
+	v, _ := i.Value()
+	assert.Equal(t, "bar", v)
+
+	// changes are pushed to the client
+	inmem.Add(configstore.NewItem("baz", "buz", 0))
+	upstream.NotifyWatchers()
+	storetest.WaitNotification(t, ch)
+	v, err = s.GetItemValue("baz")
+	require.NoError(t, err)
+	assert.Equal(t, "buz", v)
+}
+
+func TestServerEndpoints(t *testing.T) {
+	upstream := configstore.NewStore()
+	defer upstream.Close()
+	upstream.InMemory("upstream").Add(configstore.NewItem("foo", "bar", 0), configstore.NewItem("other", "x", 0))
+
+	srv := NewServer(upstream, ServerConfig{Filter: configstore.Filter().Slice("foo"), MaxWait: 50 * time.Millisecond})
+	defer srv.Close()
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/snapshot")
+	require.NoError(t, err)
+	var snapshot Snapshot
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&snapshot))
+	resp.Body.Close()
+	assert.NotZero(t, snapshot.Revision)
+	require.Len(t, snapshot.Items, 1)
+	assert.Equal(t, "foo", snapshot.Items[0].Key)
+
+	req, _ := http.NewRequest(http.MethodGet, ts.URL+"/snapshot", nil)
+	req.Header.Set("If-None-Match", resp.Header.Get("ETag"))
+	resp, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotModified, resp.StatusCode)
+
+	// watching an up to date revision times out
+	resp, err = http.Get(ts.URL + "/watch?revision=" + strconv.FormatUint(snapshot.Revision, 10))
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotModified, resp.StatusCode)
+
+	// watching an outdated revision returns immediately
+	resp, err = http.Get(ts.URL + "/watch?revision=0")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestServerRestart(t *testing.T) {
+	newServer := func(value string) *Server {
+		upstream := configstore.NewStore()
+		t.Cleanup(func() { upstream.Close() })
+		upstream.InMemory("upstream").Add(configstore.NewItem("foo", value, 0))
+		srv := NewServer(upstream, ServerConfig{})
+		t.Cleanup(func() { srv.Close() })
+		return srv
+	}
+	var current atomic.Pointer[Server]
+	current.Store(newServer("v1"))
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		current.Load().ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+
+	s := configstore.NewStore()
+	defer s.Close()
+	ch := s.Watch()
+	require.NoError(t, Register(s, ts.URL, ClientConfig{MaxWait: time.Second, RetryDelay: 10 * time.Millisecond}))
+	storetest.WaitNotification(t, ch)
+	v, err := s.GetItemValue("foo")
+	require.NoError(t, err)
+	assert.Equal(t, "v1", v)
+
+	// the restarted server is at its first change too, with other items
+	prev := current.Swap(newServer("v2"))
+	prev.Close()
+	storetest.WaitNotification(t, ch)
+	v, err = s.GetItemValue("foo")
+	require.NoError(t, err)
+	assert.Equal(t, "v2", v)
+	state := s.ProviderStatus()["configserver:"+ts.URL]
+	assert.NoError(t, state.LastError)
+	assert.True(t, state.Watching)
+}
+
+func TestServerSensitiveItems(t *testing.T) {
+	upstream := configstore.NewStore()
+	defer upstream.Close()
+	upstream.FileTree("../tests/fixtures/filetreeprovider4")
+
+	for _, include := range []bool{false, true} {
+		srv := NewServer(upstream, ServerConfig{IncludeSensitive: include})
+		ts := httptest.NewServer(srv)
+
+		s := configstore.NewStore()
+		require.NoError(t, Register(s, ts.URL, ClientConfig{}))
+		i, err := s.GetItem("secret")
+		if include {
+			require.NoError(t, err)
+			assert.True(t, i.Sensitive())
+		} else {
+			assert.ErrorIs(t, err, configstore.ErrNotFound)
+		}
+
+		s.Close()
+		ts.Close()
+		srv.Close()
+	}
+}
+
+func TestFactory(t *testing.T) {
+	upstream := configstore.NewStore()
+	defer upstream.Close()
+	upstream.InMemory("upstream").Add(configstore.NewItem("foo", "bar", 0))
+	srv := NewServer(upstream, ServerConfig{})
+	defer srv.Close()
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	t.Setenv(configstore.ConfigEnvVar, "configserver:"+ts.URL+"?max-wait=1s")
+	s := configstore.NewStore()
+	defer s.Close()
+	require.NoError(t, s.InitFromEnvironment())
+	v, err := s.GetItemValue("foo")
+	require.NoError(t, err)
+	assert.Equal(t, "bar", v)
+
+	// the provider fails until the server is reachable
+	ts.Close()
+	s2 := configstore.NewStore()
+	defer s2.Close()
+	t.Setenv(configstore.ConfigEnvVar, "configserver:"+ts.URL)
+	require.Error(t, s2.InitFromEnvironment())
+	_, err = s2.GetItemList()
+	assert.ErrorIs(t, err, configstore.ErrProviderFailed)
+}
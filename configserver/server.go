@@ -0,0 +1,237 @@
+// Package configserver exposes the items of a configstore over HTTP, and provides the matching client provider,
+// so that the configuration of a fleet can be served by a single process using configstore on both sides.
+//
+// The server exposes two endpoints:
+//
+//	GET /snapshot            the current items, along with their revision
+//	GET /watch?revision=<n>  long-polls until the revision differs from n, then returns the items
+//
+// The revisions are not reused when the server restarts, so that the clients reconnecting to it get its items.
+//
+// On the client side, importing the package registers the "configserver" provider factory:
+//
+//	CONFIGURATION_FROM=configserver:http://config.internal:8080
+package configserver
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ovh/configstore"
+)
+
+// DefaultMaxWait is the default maximum duration of a long-polling watch request.
+const DefaultMaxWait = 30 * time.Second
+
+// ServerConfig configures a Server.
+type ServerConfig struct {
+	// Filter selects the exposed items. If nil, all the store items are exposed.
+	Filter *configstore.ItemFilter
+	// IncludeSensitive exposes the items flagged as sensitive, which are excluded by default.
+	IncludeSensitive bool
+	// MaxWait caps the duration of watch requests (DefaultMaxWait by default).
+	MaxWait time.Duration
+}
+
+// Snapshot is the payload returned by the server endpoints.
+type Snapshot struct {
+	// Revision changes every time the exposed items change. It starts at a random value, so that the revisions of
+	// a restarted server do not match the ones known by its clients.
+	Revision uint64 `json:"revision"`
+	// Items are the exposed items.
+	Items []Item `json:"items"`
+}
+
+// Item is an exposed item.
+type Item struct {
+	Key       string `json:"key"`
+	Value     string `json:"value"`
+	Priority  int64  `json:"priority"`
+	Sensitive bool   `json:"sensitive,omitempty"`
+}
+
+// Server serves the items of a store over HTTP. See the package documentation for the endpoints.
+type Server struct {
+	store *configstore.Store
+	cfg   ServerConfig
+	mux   *http.ServeMux
+
+	mut      sync.Mutex
+	snapshot []byte
+	revision uint64
+	hash     [sha256.Size]byte
+	err      error
+	changed  chan struct{}
+	closed   chan struct{}
+	once     sync.Once
+}
+
+// NewServer returns a server exposing the items of store. It follows the store changes until Close is called.
+func NewServer(store *configstore.Store, cfg ServerConfig) *Server {
+	if cfg.MaxWait <= 0 {
+		cfg.MaxWait = DefaultMaxWait
+	}
+	srv := &Server{
+		store: store,
+		cfg:   cfg,
+		mux:   http.NewServeMux(),
+		// a random epoch in the high bits, the counter in the low bits
+		revision: uint64(rand.Uint32()|1) << 32,
+		changed:  make(chan struct{}),
+		closed:   make(chan struct{}),
+	}
+	srv.mux.HandleFunc("GET /snapshot", srv.handleSnapshot)
+	srv.mux.HandleFunc("GET /watch", srv.handleWatch)
+
+	ch := store.Watch()
+	srv.update()
+	go func() {
+		for {
+			select {
+			case <-srv.closed:
+				return
+			case <-store.Done():
+				return
+			case <-ch:
+				srv.update()
+			}
+		}
+	}()
+	return srv
+}
+
+// Close stops following the store changes.
+func (srv *Server) Close() error {
+	srv.once.Do(func() { close(srv.closed) })
+	return nil
+}
+
+// ServeHTTP implements http.Handler.
+func (srv *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	srv.mux.ServeHTTP(w, r)
+}
+
+// update reads the store items, and bumps the revision if they changed.
+func (srv *Server) update() {
+	// a nil filter exposes all the items
+	items, err := srv.cfg.Filter.Store(srv.store).GetItemList()
+
+	srv.mut.Lock()
+	defer srv.mut.Unlock()
+	if err != nil {
+		// keep serving the previous snapshot
+		srv.err = err
+		logError(err)
+		return
+	}
+	srv.err = nil
+
+	exposed := make([]Item, 0, len(items.Items))
+	for _, it := range items.Items {
+		if it.Sensitive() && !srv.cfg.IncludeSensitive {
+			continue
+		}
+		// the raw value is exposed, even if a filter failed to unmarshal it
+		v, _ := it.Value()
+		exposed = append(exposed, Item{Key: it.Key(), Value: v, Priority: it.Priority(), Sensitive: it.Sensitive()})
+	}
+	payload, err := json.Marshal(exposed)
+	if err != nil {
+		logError(err)
+		return
+	}
+	h := sha256.Sum256(payload)
+	if h == srv.hash && srv.snapshot != nil {
+		return
+	}
+	srv.hash = h
+	srv.revision++
+	srv.snapshot, err = json.Marshal(Snapshot{Revision: srv.revision, Items: exposed})
+	if err != nil {
+		logError(err)
+		return
+	}
+	close(srv.changed)
+	srv.changed = make(chan struct{})
+}
+
+// current returns the current snapshot, its revision, and a channel closed on the next change.
+func (srv *Server) current() ([]byte, uint64, chan struct{}, error) {
+	srv.mut.Lock()
+	defer srv.mut.Unlock()
+	if srv.snapshot == nil {
+		return nil, 0, srv.changed, srv.err
+	}
+	return srv.snapshot, srv.revision, srv.changed, nil
+}
+
+func (srv *Server) handleSnapshot(w http.ResponseWriter, r *http.Request) {
+	snapshot, revision, _, err := srv.current()
+	if snapshot == nil {
+		http.Error(w, errorMessage(err), http.StatusServiceUnavailable)
+		return
+	}
+	etag := strconv.Quote(strconv.FormatUint(revision, 10))
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	writeSnapshot(w, snapshot, etag)
+}
+
+func (srv *Server) handleWatch(w http.ResponseWriter, r *http.Request) {
+	known, _ := strconv.ParseUint(r.URL.Query().Get("revision"), 10, 64)
+	wait := srv.cfg.MaxWait
+	if d, err := time.ParseDuration(r.URL.Query().Get("timeout")); err == nil && d > 0 && d < wait {
+		wait = d
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	for {
+		snapshot, revision, changed, err := srv.current()
+		if snapshot != nil && revision != known {
+			writeSnapshot(w, snapshot, strconv.Quote(strconv.FormatUint(revision, 10)))
+			return
+		}
+		select {
+		case <-changed:
+		case <-timer.C:
+			if snapshot == nil {
+				http.Error(w, errorMessage(err), http.StatusServiceUnavailable)
+				return
+			}
+			w.WriteHeader(http.StatusNotModified)
+			return
+		case <-r.Context().Done():
+			return
+		case <-srv.closed:
+			http.Error(w, "server closed", http.StatusServiceUnavailable)
+			return
+		}
+	}
+}
+
+func writeSnapshot(w http.ResponseWriter, snapshot []byte, etag string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", etag)
+	_, _ = w.Write(snapshot)
+}
+
+func errorMessage(err error) string {
+	if err == nil {
+		return "no configuration available"
+	}
+	return err.Error()
+}
+
+func logError(err error) {
+	if configstore.LogErrorFunc != nil {
+		configstore.LogErrorFunc("error: %v", err)
+	}
+}
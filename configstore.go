@@ -2,6 +2,7 @@ package configstore
 
 import (
 	"fmt"
+	"sort"
 	"sync"
 )
 
@@ -11,18 +12,125 @@ const (
 )
 
 var (
-	providerFactories = map[string]ProviderFactory{}
+	providerFactories = map[string]ProviderFactoryInfo{}
 	pFactMut          sync.Mutex
 )
 
 func init() {
-	RegisterProviderFactory("file", fileProvider)
-	RegisterProviderFactory("file+refresh", fileRefreshProvider)
-	RegisterProviderFactory("filelist", fileListProvider)
-	RegisterProviderFactory("filelist+refresh", fileListRefreshProvider)
-	RegisterProviderFactory("filetree", fileTreeProvider)
-	RegisterProviderFactory("filetree+refresh", fileTreeRefreshProvider)
-	RegisterProviderFactory("env", envProvider)
+	RegisterProviderFactoryInfo(ProviderFactoryInfo{
+		Name:        "file",
+		Description: "Reads items from a YAML or JSON file.",
+		Syntax:      "file:<path>",
+		Examples:    []string{"file:/etc/myapp/config.yaml"},
+		Options:     []string{"optional"},
+		Factory:     fileFactory(refreshNone),
+	})
+	RegisterProviderFactoryInfo(ProviderFactoryInfo{
+		Name:        "file+refresh",
+		Description: "Reads items from a YAML or JSON file, and reloads them when the file changes.",
+		Syntax:      "file+refresh:<path>",
+		Examples:    []string{"file+refresh:/etc/myapp/config.yaml"},
+		Options:     []string{"interval", "debounce", "optional"},
+		Factory:     fileFactory(refreshNotify),
+	})
+	RegisterProviderFactoryInfo(ProviderFactoryInfo{
+		Name:        "file+poll",
+		Description: "Reads items from a YAML or JSON file, and polls it for changes.",
+		Syntax:      "file+poll:<path>",
+		Examples:    []string{"file+poll:/mnt/nfs/config.yaml?interval=30s"},
+		Options:     []string{"interval", "debounce", "optional"},
+		Factory:     fileFactory(refreshPoll),
+	})
+	RegisterProviderFactoryInfo(ProviderFactoryInfo{
+		Name:        "filelist",
+		Description: "Reads items from all the YAML or JSON files of a directory.",
+		Syntax:      "filelist:<directory>",
+		Examples:    []string{"filelist:/etc/myapp/conf.d"},
+		Options:     []string{"optional"},
+		Factory:     fileListFactory(refreshNone),
+	})
+	RegisterProviderFactoryInfo(ProviderFactoryInfo{
+		Name:        "filelist+refresh",
+		Description: "Reads items from all the YAML or JSON files of a directory, and reloads them when the files change.",
+		Syntax:      "filelist+refresh:<directory>",
+		Examples:    []string{"filelist+refresh:/etc/myapp/conf.d"},
+		Options:     []string{"interval", "debounce", "optional"},
+		Factory:     fileListFactory(refreshNotify),
+	})
+	RegisterProviderFactoryInfo(ProviderFactoryInfo{
+		Name:        "filelist+poll",
+		Description: "Reads items from all the YAML or JSON files of a directory, and polls them for changes.",
+		Syntax:      "filelist+poll:<directory>",
+		Examples:    []string{"filelist+poll:/mnt/nfs/conf.d?interval=30s"},
+		Options:     []string{"interval", "debounce", "optional"},
+		Factory:     fileListFactory(refreshPoll),
+	})
+	RegisterProviderFactoryInfo(ProviderFactoryInfo{
+		Name:        "filetree",
+		Description: "Reads items from a file hierarchy: file names are the keys, file contents are the values.",
+		Syntax:      "filetree:<directory>",
+		Examples:    []string{"filetree:/etc/secrets"},
+		Options:     []string{"optional"},
+		Factory:     fileTreeFactory(refreshNone),
+	})
+	RegisterProviderFactoryInfo(ProviderFactoryInfo{
+		Name:        "filetree+refresh",
+		Description: "Reads items from a file hierarchy, and reloads them when the files change.",
+		Syntax:      "filetree+refresh:<directory>",
+		Examples:    []string{"filetree+refresh:/etc/secrets"},
+		Options:     []string{"interval", "debounce", "optional"},
+		Factory:     fileTreeFactory(refreshNotify),
+	})
+	RegisterProviderFactoryInfo(ProviderFactoryInfo{
+		Name:        "filetree+poll",
+		Description: "Reads items from a file hierarchy, and polls it for changes.",
+		Syntax:      "filetree+poll:<directory>",
+		Examples:    []string{"filetree+poll:/mnt/nfs/secrets?interval=30s"},
+		Options:     []string{"interval", "debounce", "optional"},
+		Factory:     fileTreeFactory(refreshPoll),
+	})
+	for _, scheme := range []string{"http", "https"} {
+		httpOptions := []string{"optional", "format", "timeout", "bearer-token-file", "cert", "key", "ca"}
+		RegisterProviderFactoryInfo(ProviderFactoryInfo{
+			Name:        scheme,
+			Description: "Fetches items from a YAML or JSON document (or any registered format) over HTTP.",
+			Syntax:      scheme + "://<host>/<path>",
+			Examples:    []string{scheme + "://config.example.com/myapp.yaml?timeout=5s"},
+			Options:     httpOptions,
+			Factory:     httpFactory(scheme, refreshNone),
+		})
+		RegisterProviderFactoryInfo(ProviderFactoryInfo{
+			Name:        scheme + "+refresh",
+			Description: "Fetches items from a document over HTTP, and polls it for changes with conditional requests.",
+			Syntax:      scheme + "+refresh://<host>/<path>",
+			Examples:    []string{scheme + "+refresh://config.example.com/myapp.yaml?interval=30s"},
+			Options:     append([]string{"interval"}, httpOptions...),
+			Factory:     httpFactory(scheme, refreshNotify),
+		})
+		RegisterProviderFactoryInfo(ProviderFactoryInfo{
+			Name:        scheme + "+poll",
+			Description: "Same as " + scheme + "+refresh.",
+			Syntax:      scheme + "+poll://<host>/<path>",
+			Examples:    []string{scheme + "+poll://config.example.com/myapp.yaml?interval=30s"},
+			Options:     append([]string{"interval"}, httpOptions...),
+			Factory:     httpFactory(scheme, refreshPoll),
+		})
+	}
+	RegisterProviderFactoryInfo(ProviderFactoryInfo{
+		Name:        "env",
+		Description: "Reads items from the environment variables starting with the given prefix.",
+		Syntax:      "env[:<prefix>]",
+		Examples:    []string{"env:MYAPP"},
+		Factory:     envProvider,
+	})
+	RegisterProviderFactoryInfo(ProviderFactoryInfo{
+		Name:        "store",
+		Description: "Configures the store itself, e.g. the number of providers called concurrently. It reads no items.",
+		Syntax:      "store:",
+		Examples:    []string{"store:?fetch-concurrency=8"},
+		Options:     []string{"fetch-concurrency"},
+		Factory:     storeFactory,
+	})
 }
 
 // A Provider retrieves config items and makes them available to the configstore,
@@ -33,16 +141,79 @@ type Provider func() (ItemList, error)
 
 // A ProviderFactory is a function that instantiates a Provider and registers it
 // to a store instance.
+//
+// Deprecated: use ProviderFactoryFunc, which can report errors, with RegisterProviderFactoryInfo.
 type ProviderFactory func(*Store, string)
 
+// A ProviderFactoryFunc is a function that instantiates a Provider from its spec and registers it
+// to a store instance.
+type ProviderFactoryFunc func(*Store, ProviderSpec) error
+
+// ProviderFactoryInfo describes a provider factory, so that it can be listed in usage information.
+// See ListProviderFactories.
+type ProviderFactoryInfo struct {
+	// Name is the name used to select the factory in ConfigEnvVar.
+	Name string
+	// Description is a one-line, human readable description of the providers instantiated by the factory.
+	Description string
+	// Syntax describes the expected argument, e.g. "file:<path>".
+	Syntax string
+	// Examples lists valid ConfigEnvVar entries.
+	Examples []string
+	// Options lists the options supported by the factory. InitFromEnvironment rejects any other option.
+	Options []string
+	// Factory instantiates and registers the providers.
+	Factory ProviderFactoryFunc
+
+	// legacy is set for the factories registered with RegisterProviderFactory, which get their argument as is.
+	legacy bool
+}
+
 // RegisterProviderFactory registers a factory function so that InitFromEnvironment can properly
 // instantiate configuration providers via name + argument.
+//
+// The factory gets the whole text following the colon, up to the next comma: options, quotes and escaping are not parsed.
+//
+// Deprecated: use RegisterProviderFactoryInfo.
 func RegisterProviderFactory(name string, f ProviderFactory) {
+	RegisterProviderFactoryInfo(ProviderFactoryInfo{
+		Name: name,
+		Factory: func(s *Store, spec ProviderSpec) error {
+			f(s, spec.Arg)
+			return nil
+		},
+		legacy: true,
+	})
+}
+
+// RegisterProviderFactoryInfo registers a described factory function so that InitFromEnvironment can properly
+// instantiate configuration providers via name + argument.
+func RegisterProviderFactoryInfo(info ProviderFactoryInfo) {
 	pFactMut.Lock()
 	defer pFactMut.Unlock()
-	_, ok := providerFactories[name]
+	_, ok := providerFactories[info.Name]
 	if ok {
-		panic(fmt.Sprintf("conflict on configuration provider factory: %s", name))
+		panic(fmt.Sprintf("conflict on configuration provider factory: %s", info.Name))
 	}
-	providerFactories[name] = f
+	providerFactories[info.Name] = info
+}
+
+// ListProviderFactories returns the description of all the registered provider factories, sorted by name.
+// This is meant to generate usage information.
+func ListProviderFactories() []ProviderFactoryInfo {
+	pFactMut.Lock()
+	defer pFactMut.Unlock()
+	ret := make([]ProviderFactoryInfo, 0, len(providerFactories))
+	for _, info := range providerFactories {
+		ret = append(ret, info)
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Name < ret[j].Name })
+	return ret
+}
+
+func getProviderFactory(name string) (ProviderFactoryInfo, bool) {
+	pFactMut.Lock()
+	defer pFactMut.Unlock()
+	info, ok := providerFactories[name]
+	return info, ok
 }
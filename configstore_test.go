@@ -2,10 +2,13 @@ package configstore
 
 import (
 	"reflect"
+	"sort"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func ProviderTest() (ItemList, error) {
@@ -158,26 +161,26 @@ func TestStore(t *testing.T) {
 
 	// Check item not found
 	_, err = items.GetItem("notfound")
-	assert.Equal(mustType(err, ErrItemNotFound("")), true)
+	assert.Equal(mustType(err, ErrItemNotFound{}), true)
 
 	_, err = items.GetItem("duration")
-	assert.Equal(mustType(err, ErrItemNotFound("")), false)
+	assert.Equal(mustType(err, ErrItemNotFound{}), false)
 
 	// Check uninitialized item list
 	tmp, items := items, nil
 	_, err = items.GetItem("duration")
-	assert.Equal(mustType(err, ErrUninitializedItemList("")), true)
+	assert.Equal(mustType(err, ErrUninitializedItemList{}), true)
 	items = tmp
 
 	_, err = items.GetItem("duration")
-	assert.Equal(mustType(err, ErrUninitializedItemList("")), false)
+	assert.Equal(mustType(err, ErrUninitializedItemList{}), false)
 
 	// Check ambigous item
 	_, err = items.GetItem("sql")
-	assert.Equal(mustType(err, ErrAmbiguousItem("")), true)
+	assert.Equal(mustType(err, &ErrAmbiguousItem{}), true)
 
 	_, err = items.GetItem("duration")
-	assert.Equal(mustType(err, ErrAmbiguousItem("")), false)
+	assert.Equal(mustType(err, &ErrAmbiguousItem{}), false)
 }
 
 func TestStoreWatch(t *testing.T) {
@@ -217,3 +220,153 @@ func must(i interface{}, err error) interface{} {
 func mustType(a interface{}, b interface{}) bool {
 	return reflect.TypeOf(a) == reflect.TypeOf(b)
 }
+
+func TestInitFromEnvironmentErrors(t *testing.T) {
+	t.Setenv(ConfigEnvVar, "file:tests/fixtures/fileprovider/test.yaml,file:/does/not/exist.yaml,unknownfactory:foo")
+
+	s := NewStore()
+	err := s.InitFromEnvironment()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "/does/not/exist.yaml")
+	assert.Contains(t, err.Error(), "unknownfactory")
+	assert.NotContains(t, err.Error(), "test.yaml")
+
+	// failing providers are still visible through GetItemList
+	_, err = s.GetItemList()
+	assert.Error(t, err)
+
+	t.Setenv(ConfigEnvVar, "file:tests/fixtures/fileprovider/test.yaml")
+	assert.NoError(t, NewStore().InitFromEnvironment())
+}
+
+func TestListProviderFactories(t *testing.T) {
+	factories := ListProviderFactories()
+	names := make([]string, 0, len(factories))
+	for _, f := range factories {
+		names = append(names, f.Name)
+	}
+	assert.Subset(t, names, []string{"env", "file", "file+poll", "file+refresh", "filelist", "filetree"})
+	assert.True(t, sort.StringsAreSorted(names))
+
+	for _, f := range factories {
+		if f.Name == "file" {
+			assert.NotEmpty(t, f.Description)
+			assert.Equal(t, "file:<path>", f.Syntax)
+			assert.NotEmpty(t, f.Examples)
+		}
+	}
+}
+
+func TestMergeOrder(t *testing.T) {
+	values := func(l *ItemList) []string {
+		var ret []string
+		for _, i := range l.Items {
+			ret = append(ret, i.value)
+		}
+		return ret
+	}
+
+	for i := 0; i < 20; i++ {
+		s := NewStore()
+		s.AllowProviderOverride()
+		s.InMemory("c").Add(NewItem("foo", "c", 1))
+		s.InMemory("a").Add(NewItem("foo", "a", 1), NewItem("bar", "a", 2))
+		s.InMemory("b").Add(NewItem("foo", "b", 1))
+		s.InMemory("first", Rank(-1)).Add(NewItem("foo", "first", 1))
+		s.InMemory("last", Rank(1)).Add(NewItem("foo", "last", 1))
+		// an overridden provider keeps its position
+		s.InMemory("a").Add(NewItem("foo", "a2", 1), NewItem("bar", "a2", 2))
+
+		items, err := s.GetItemList()
+		require.NoError(t, err)
+		assert.Equal(t, []string{"a2", "first", "c", "a2", "b", "last"}, values(items))
+		assert.Equal(t, []string{"bar", "foo"}, items.Keys())
+
+		first, err := Filter().Slice("foo").Store(s).GetFirstItem()
+		require.NoError(t, err)
+		assert.Equal(t, "first", first.value)
+
+		squashed, err := Filter().Squash().Store(s).GetItemList()
+		require.NoError(t, err)
+		assert.Equal(t, []string{"a2", "first", "c", "a2", "b", "last"}, values(squashed))
+		s.Close()
+	}
+}
+
+func TestParallelFetch(t *testing.T) {
+	s := NewStore()
+	defer s.Close()
+	s.SetFetchConcurrency(2)
+
+	var mut sync.Mutex
+	running, maxRunning := 0, 0
+	for _, name := range []string{"a", "b", "c", "d", "e"} {
+		name := name
+		s.RegisterProvider(name, func() (ItemList, error) {
+			mut.Lock()
+			running++
+			maxRunning = max(maxRunning, running)
+			mut.Unlock()
+			time.Sleep(20 * time.Millisecond)
+			mut.Lock()
+			running--
+			mut.Unlock()
+			return ItemList{Items: []Item{NewItem("key", name, 0)}}, nil
+		})
+	}
+
+	items, err := s.GetItemList()
+	require.NoError(t, err)
+	assert.Equal(t, 2, maxRunning)
+	var values []string
+	for _, i := range items.Items {
+		values = append(values, i.value)
+	}
+	assert.Equal(t, []string{"a", "b", "c", "d", "e"}, values)
+}
+
+func TestStoreFactory(t *testing.T) {
+	t.Setenv(ConfigEnvVar, "store:?fetch-concurrency=4,env:CONFIGSTORE_STORETEST")
+	s := NewStore()
+	defer s.Close()
+	require.NoError(t, s.InitFromEnvironment())
+	assert.Equal(t, 4, s.fetchConcurrency)
+	_, err := s.GetItemList()
+	require.NoError(t, err)
+
+	for _, cfg := range []string{"store:?fetch-concurrency=0", "store:?fetch-concurrency=many", "store:?fetch=4", "store:foo"} {
+		t.Setenv(ConfigEnvVar, cfg)
+		s := NewStore()
+		defer s.Close()
+		assert.Error(t, s.InitFromEnvironment(), cfg)
+		assert.Equal(t, DefaultFetchConcurrency, s.fetchConcurrency, cfg)
+	}
+}
+
+func TestProviderRegisteringProvider(t *testing.T) {
+	s := NewStore()
+	defer s.Close()
+	var once sync.Once
+	s.RegisterProvider("parent", func() (ItemList, error) {
+		once.Do(func() {
+			s.InMemory("child").Add(NewItem("child", "value", 0))
+		})
+		return ItemList{}, nil
+	})
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, err := s.GetItemList()
+		assert.NoError(t, err)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "GetItemList deadlocked")
+	}
+
+	v, err := s.GetItemValue("child")
+	require.NoError(t, err)
+	assert.Equal(t, "value", v)
+}
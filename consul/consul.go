@@ -0,0 +1,253 @@
+// Package consul provides a configstore provider reading a Consul KV prefix.
+//
+// Each key under the prefix (usually ending with a slash) becomes an item, named after the key path relative to the prefix.
+// The item priority is read from a "@<priority>" key suffix (e.g. "myapp/db/url@20" is the item "db/url" with priority 20),
+// or else from the key flags, or else defaults to Config.Priority.
+//
+// Importing the package registers the "consul" provider factory:
+//
+//	CONFIGURATION_FROM=consul:myapp?refresh=true&address=http://consul.internal:8500&token-file=/run/secrets/consul
+//
+// The refreshing variant follows the prefix with blocking queries, so that watchers get notified as soon as a key changes.
+package consul
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ovh/configstore"
+)
+
+func init() {
+	for _, refresh := range []bool{false, true} {
+		name := "consul"
+		if refresh {
+			name += "+refresh"
+		}
+		configstore.RegisterProviderFactoryInfo(configstore.ProviderFactoryInfo{
+			Name:        name,
+			Description: "Reads the keys under a Consul KV prefix.",
+			Syntax:      name + ":<prefix>",
+			Examples:    []string{name + ":myapp?address=http://consul.internal:8500"},
+			Options:     []string{"address", "token-file", "datacenter", "wait", "retry-delay"},
+			Factory:     factory(refresh),
+		})
+	}
+}
+
+const (
+	// DefaultAddress is the address of the Consul agent, when neither Config.Address nor CONSUL_HTTP_ADDR are set.
+	DefaultAddress = "http://127.0.0.1:8500"
+	// DefaultWaitTime is the default maximum duration of a blocking query.
+	DefaultWaitTime = 5 * time.Minute
+	// DefaultRetryDelay is the default delay between two blocking queries, after a failure.
+	DefaultRetryDelay = time.Second
+)
+
+// Config configures the consul provider, see Register.
+type Config struct {
+	// Address is the address of the Consul agent (CONSUL_HTTP_ADDR, or DefaultAddress by default).
+	Address string
+	// Token is the ACL token (CONSUL_HTTP_TOKEN by default).
+	Token string
+	// TokenFile is the path of a file holding the ACL token. It is read before each request, so that the token can be rotated.
+	TokenFile string
+	// Datacenter is the datacenter to query (the agent datacenter by default).
+	Datacenter string
+	// HTTPClient is the client used for the requests (http.DefaultClient by default). Its timeout, if any,
+	// must be longer than WaitTime.
+	HTTPClient *http.Client
+	// Priority is the priority of the items whose key has neither a priority suffix nor flags.
+	Priority int64
+	// Watch follows the prefix with blocking queries, and notifies the watchers on changes.
+	Watch bool
+	// WaitTime is the maximum duration of a blocking query (DefaultWaitTime by default).
+	WaitTime time.Duration
+	// RetryDelay is the delay before the next blocking query after a failure (DefaultRetryDelay by default).
+	RetryDelay time.Duration
+}
+
+func factory(refresh bool) configstore.ProviderFactoryFunc {
+	return func(s *configstore.Store, spec configstore.ProviderSpec) error {
+		cfg := Config{
+			Address:    spec.Option("address"),
+			TokenFile:  spec.Option("token-file"),
+			Datacenter: spec.Option("datacenter"),
+			Watch:      refresh,
+		}
+		var err error
+		cfg.WaitTime, err = spec.DurationOption("wait", 0)
+		if err == nil {
+			cfg.RetryDelay, err = spec.DurationOption("retry-delay", 0)
+		}
+		if err != nil {
+			s.ErrorProvider("consul:"+spec.Arg, err)
+			return err
+		}
+		return Register(s, spec.Arg, cfg, spec.ProviderOptions()...)
+	}
+}
+
+// kvPair is an entry of the Consul KV API.
+type kvPair struct {
+	Key   string
+	Flags uint64
+	Value []byte // base64 in the JSON payload
+}
+
+// client keeps a local copy of the items read from a Consul KV prefix.
+type client struct {
+	*configstore.Remote
+	prefix string
+	cfg    Config
+
+	// only used by the goroutine following the prefix
+	index uint64
+}
+
+// Register registers a provider reading the keys under the given Consul KV prefix, named "consul:<prefix>".
+// If cfg.Watch is set, the provider follows the prefix with blocking queries until the store is closed, and
+// the watchers get notified when the items change (see configstore.Remote for the handling of failures).
+func Register(s *configstore.Store, prefix string, cfg Config, opts ...configstore.ProviderOption) error {
+	if cfg.Address == "" {
+		cfg.Address = os.Getenv("CONSUL_HTTP_ADDR")
+	}
+	if cfg.Address == "" {
+		cfg.Address = DefaultAddress
+	}
+	if !strings.Contains(cfg.Address, "://") {
+		cfg.Address = "http://" + cfg.Address
+	}
+	cfg.Address = strings.TrimSuffix(cfg.Address, "/")
+	if cfg.Token == "" && cfg.TokenFile == "" {
+		cfg.Token = os.Getenv("CONSUL_HTTP_TOKEN")
+	}
+	if cfg.HTTPClient == nil {
+		cfg.HTTPClient = http.DefaultClient
+	}
+	if cfg.WaitTime <= 0 {
+		cfg.WaitTime = DefaultWaitTime
+	}
+	if cfg.RetryDelay <= 0 {
+		cfg.RetryDelay = DefaultRetryDelay
+	}
+	c := &client{Remote: s.NewRemote("consul:" + prefix), prefix: strings.TrimPrefix(prefix, "/"), cfg: cfg}
+
+	items, index, err := c.fetch(c.Context(), 0)
+	if err == nil {
+		c.index = index
+		c.Set(items...)
+	}
+	err = c.Register(err, cfg.Watch, opts...)
+	if cfg.Watch {
+		go c.follow(c.Context())
+	}
+	return err
+}
+
+// follow runs blocking queries on the prefix, until ctx is done.
+func (c *client) follow(ctx context.Context) {
+	for ctx.Err() == nil {
+		items, index, err := c.fetch(ctx, c.index)
+		switch {
+		case ctx.Err() != nil:
+			return
+		case err != nil:
+			c.Fail(err)
+			select {
+			case <-ctx.Done():
+			case <-time.After(c.cfg.RetryDelay):
+			}
+		case index < c.index:
+			// the index went backwards (e.g. the Consul state was restored): start over
+			c.index = 0
+			c.Update(items...)
+		default:
+			// the watchers are only notified if the items changed, the provider recovers otherwise
+			c.index = index
+			c.Update(items...)
+		}
+	}
+}
+
+// fetch reads the prefix. With a non-zero index, the request blocks until the prefix changes or the wait time expires.
+func (c *client) fetch(ctx context.Context, index uint64) ([]configstore.Item, uint64, error) {
+	query := url.Values{"recurse": {"true"}}
+	if c.cfg.Datacenter != "" {
+		query.Set("dc", c.cfg.Datacenter)
+	}
+	if index > 0 {
+		query.Set("index", strconv.FormatUint(index, 10))
+		query.Set("wait", c.cfg.WaitTime.String())
+	}
+	endpoint := c.cfg.Address + "/v1/kv/" + c.prefix + "?" + query.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	token := c.cfg.Token
+	if c.cfg.TokenFile != "" {
+		b, err := os.ReadFile(c.cfg.TokenFile)
+		if err != nil {
+			return nil, 0, err
+		}
+		token = strings.TrimSpace(string(b))
+	}
+	if token != "" {
+		req.Header.Set("X-Consul-Token", token)
+	}
+
+	resp, err := c.cfg.HTTPClient.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+
+	var pairs []kvPair
+	switch resp.StatusCode {
+	case http.StatusOK:
+		if err := json.NewDecoder(resp.Body).Decode(&pairs); err != nil {
+			return nil, 0, fmt.Errorf("consul: %s: %w", c.prefix, err)
+		}
+	case http.StatusNotFound:
+		// no key under the prefix (yet)
+	default:
+		return nil, 0, fmt.Errorf("consul: %s: unexpected status: %s", c.prefix, resp.Status)
+	}
+	newIndex, err := strconv.ParseUint(resp.Header.Get("X-Consul-Index"), 10, 64)
+	if err != nil || newIndex == 0 {
+		return nil, 0, errors.New("consul: " + c.prefix + ": missing or invalid X-Consul-Index header")
+	}
+	return c.items(pairs), newIndex, nil
+}
+
+// items maps the KV pairs to items.
+func (c *client) items(pairs []kvPair) []configstore.Item {
+	ret := make([]configstore.Item, 0, len(pairs))
+	for _, p := range pairs {
+		key := strings.TrimPrefix(strings.TrimPrefix(p.Key, c.prefix), "/")
+		if key == "" || strings.HasSuffix(key, "/") {
+			// the prefix itself, or a folder
+			continue
+		}
+		priority := c.cfg.Priority
+		if p.Flags != 0 {
+			priority = int64(p.Flags)
+		}
+		if i := strings.LastIndexByte(key, '@'); i > 0 {
+			if n, err := strconv.ParseInt(key[i+1:], 10, 64); err == nil {
+				key, priority = key[:i], n
+			}
+		}
+		ret = append(ret, configstore.NewItem(key, string(p.Value), priority))
+	}
+	return ret
+}
@@ -0,0 +1,170 @@
+package consul
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ovh/configstore"
+	"github.com/ovh/configstore/internal/storetest"
+)
+
+// fakeConsul mimics the Consul KV API, including blocking queries.
+type fakeConsul struct {
+	mut     sync.Mutex
+	pairs   map[string]kvPair
+	index   uint64
+	changed chan struct{}
+	token   string
+	fail    bool
+}
+
+func newFakeConsul() *fakeConsul {
+	return &fakeConsul{pairs: map[string]kvPair{}, index: 1, changed: make(chan struct{})}
+}
+
+func (f *fakeConsul) put(key, value string, flags uint64) {
+	f.mut.Lock()
+	defer f.mut.Unlock()
+	f.pairs[key] = kvPair{Key: key, Value: []byte(value), Flags: flags}
+	f.index++
+	close(f.changed)
+	f.changed = make(chan struct{})
+}
+
+func (f *fakeConsul) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mut.Lock()
+	f.token = r.Header.Get("X-Consul-Token")
+	if f.fail {
+		f.mut.Unlock()
+		http.Error(w, "unavailable", http.StatusInternalServerError)
+		return
+	}
+	index, _ := strconv.ParseUint(r.URL.Query().Get("index"), 10, 64)
+	if index > 0 && index >= f.index {
+		changed := f.changed
+		f.mut.Unlock()
+		wait, _ := time.ParseDuration(r.URL.Query().Get("wait"))
+		select {
+		case <-changed:
+		case <-time.After(wait):
+		case <-r.Context().Done():
+			return
+		}
+		f.mut.Lock()
+	}
+	defer f.mut.Unlock()
+
+	prefix := strings.TrimPrefix(r.URL.Path, "/v1/kv/")
+	var pairs []kvPair
+	for k, p := range f.pairs {
+		if strings.HasPrefix(k, prefix) {
+			pairs = append(pairs, p)
+		}
+	}
+	sort.Slice(pairs, func(i, j int) bool { return pairs[i].Key < pairs[j].Key })
+	w.Header().Set("X-Consul-Index", strconv.FormatUint(f.index, 10))
+	if len(pairs) == 0 {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	_ = json.NewEncoder(w).Encode(pairs)
+}
+
+func TestConsulProvider(t *testing.T) {
+	fake := newFakeConsul()
+	fake.put("myapp/db/url", "postgres://db", 0)
+	fake.put("myapp/db/pool@20", "10", 0)
+	fake.put("myapp/flagged", "x", 7)
+	fake.put("myapp/folder/", "", 0)
+	fake.put("other/key", "y", 0)
+	ts := httptest.NewServer(fake)
+	defer ts.Close()
+
+	s := configstore.NewStore()
+	defer s.Close()
+	require.NoError(t, Register(s, "myapp/", Config{Address: ts.URL, Token: "secret", Priority: 3}))
+
+	items, err := s.GetItemList()
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"db/pool", "db/url", "flagged"}, items.Keys())
+	assert.Equal(t, "secret", fake.token)
+
+	for key, priority := range map[string]int64{"db/url": 3, "db/pool": 20, "flagged": 7} {
+		i, err := items.GetItem(key)
+		require.NoError(t, err)
+		assert.Equal(t, priority, i.Priority(), key)
+		assert.Equal(t, "consul:myapp/", i.Provider())
+	}
+	v, err := items.GetItemValue("db/url")
+	require.NoError(t, err)
+	assert.Equal(t, "postgres://db", v)
+}
+
+func TestConsulProviderWatch(t *testing.T) {
+	fake := newFakeConsul()
+	fake.put("myapp/foo", "bar", 0)
+	ts := httptest.NewServer(fake)
+	defer ts.Close()
+
+	s := configstore.NewStore()
+	defer s.Close()
+	ch := s.Watch()
+	require.NoError(t, Register(s, "myapp/", Config{Address: ts.URL, Watch: true, WaitTime: time.Second}))
+	storetest.WaitNotification(t, ch)
+
+	// the blocking query returns as soon as a key changes
+	fake.put("myapp/foo", "baz", 0)
+	storetest.WaitNotification(t, ch)
+	v, err := s.GetItemValue("foo")
+	require.NoError(t, err)
+	assert.Equal(t, "baz", v)
+
+	// unrelated changes do not notify
+	fake.put("other/key", "y", 0)
+	select {
+	case <-ch:
+		assert.Fail(t, "unexpected notification")
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+func TestConsulProviderFailure(t *testing.T) {
+	fake := newFakeConsul()
+	fake.fail = true
+	ts := httptest.NewServer(fake)
+	defer ts.Close()
+
+	s := configstore.NewStore()
+	defer s.Close()
+	assert.Error(t, Register(s, "static/", Config{Address: ts.URL}))
+	_, err := s.GetItemList()
+	assert.Error(t, err)
+
+	// when watching, the provider fails until consul answers
+	s = configstore.NewStore()
+	defer s.Close()
+	ch := s.Watch()
+	assert.Error(t, Register(s, "myapp/", Config{Address: ts.URL, Watch: true, WaitTime: time.Second, RetryDelay: 10 * time.Millisecond}))
+	storetest.WaitNotification(t, ch)
+	_, err = s.GetItemList()
+	assert.Error(t, err)
+
+	fake.mut.Lock()
+	fake.fail = false
+	fake.mut.Unlock()
+	fake.put("myapp/foo", "bar", 0)
+	storetest.WaitNotification(t, ch)
+	v, err := s.GetItemValue("foo")
+	require.NoError(t, err)
+	assert.Equal(t, "bar", v)
+}
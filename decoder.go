@@ -0,0 +1,110 @@
+package configstore
+
+import (
+	"fmt"
+	"mime"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/ghodss/yaml"
+)
+
+// A Decoder converts a document (e.g. the content of a file or an HTTP response body) into items.
+type Decoder func([]byte) ([]Item, error)
+
+var (
+	decoders    = map[string]Decoder{}
+	decodersMut sync.Mutex
+)
+
+func init() {
+	RegisterDecoder("yaml", decodeItems)
+	RegisterDecoder("json", decodeItems)
+}
+
+// RegisterDecoder registers a decoder under a format name, so that it can be selected by the providers
+// fetching documents (e.g. the "format" option of the http provider).
+func RegisterDecoder(format string, d Decoder) {
+	decodersMut.Lock()
+	defer decodersMut.Unlock()
+	if _, ok := decoders[format]; ok {
+		panic(fmt.Sprintf("conflict on configuration decoder: %s", format))
+	}
+	decoders[format] = d
+}
+
+// ListDecoders returns the names of the registered decoders, sorted.
+func ListDecoders() []string {
+	decodersMut.Lock()
+	defer decodersMut.Unlock()
+	ret := make([]string, 0, len(decoders))
+	for name := range decoders {
+		ret = append(ret, name)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// Decode decodes a document with the decoder registered under format. If format is empty, it is detected
+// from the content type of the document, if any, then from the extension of its name (see the http provider).
+// It is meant to be used by provider implementations fetching documents.
+func Decode(format, contentType, name string, b []byte) ([]Item, error) {
+	if format == "" {
+		format = detectFormat(contentType, name)
+	}
+	decode, err := getDecoder(format)
+	if err != nil {
+		return nil, err
+	}
+	return decode(b)
+}
+
+func getDecoder(format string) (Decoder, error) {
+	decodersMut.Lock()
+	defer decodersMut.Unlock()
+	d, ok := decoders[format]
+	if !ok {
+		return nil, fmt.Errorf("unknown format '%s'", format)
+	}
+	return d, nil
+}
+
+// detectFormat guesses the format of a document from its content type, then from its name extension.
+// It defaults to "yaml", which also handles JSON documents.
+func detectFormat(contentType, name string) string {
+	if mediaType, _, err := mime.ParseMediaType(contentType); err == nil {
+		switch {
+		case mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"):
+			return "json"
+		case strings.HasSuffix(mediaType, "yaml"):
+			return "yaml"
+		}
+	}
+	switch strings.ToLower(path.Ext(name)) {
+	case ".json":
+		return "json"
+	case ".yaml", ".yml":
+		return "yaml"
+	}
+	if ext := strings.TrimPrefix(path.Ext(name), "."); ext != "" {
+		decodersMut.Lock()
+		_, ok := decoders[ext]
+		decodersMut.Unlock()
+		if ok {
+			return ext
+		}
+	}
+	return "yaml"
+}
+
+// decodeItems decodes a list of items in the YAML or JSON format of the file provider.
+func decodeItems(b []byte) ([]Item, error) {
+	var vals []Item
+	err := yaml.Unmarshal(b, &vals)
+	if err != nil {
+		return nil, err
+	}
+	return vals, nil
+}
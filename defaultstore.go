@@ -1,6 +1,8 @@
 package configstore
 
 import (
+	"context"
+	"os"
 	"time"
 )
 
@@ -13,18 +15,29 @@ var (
  */
 
 // InitFromEnvironment initializes configuration providers via their name and an optional argument.
-// Suitable provider factories should have been registered via RegisterProviderFactory for this to work.
-// Built-in providers (File, FileList, FileTree, ...) are registered by default.
+// Suitable provider factories should have been registered via RegisterProviderFactoryInfo for this to work.
+// Built-in providers (File, FileList, FileTree, ...) are registered by default, see ListProviderFactories.
 //
 // Valid example:
 // CONFIGURATION_FROM=file:/etc/myfile.conf,file:/etc/myfile2.conf,filelist:/home/foobar/configs
-func InitFromEnvironment() {
-	DefaultStore.InitFromEnvironment()
+//
+// See ProviderSpec for the complete syntax, including options and escaping rules, e.g.
+// CONFIGURATION_FROM=file:/etc/myfile.conf?refresh=true,filetree:"/etc/my,secrets"
+//
+// The returned error aggregates the errors of all the providers which failed to initialize.
+// These providers are registered as error providers, so that GetItemList fails as well.
+func InitFromEnvironment() error {
+	return DefaultStore.InitFromEnvironment()
 }
 
 // RegisterProvider registers a provider
-func RegisterProvider(name string, f Provider) {
-	DefaultStore.RegisterProvider(name, f)
+func RegisterProvider(name string, f Provider, opts ...ProviderOption) {
+	DefaultStore.RegisterProvider(name, f, opts...)
+}
+
+// RegisterReloadableProvider registers a provider which is able to re-read its source on demand, see Reload().
+func RegisterReloadableProvider(name string, p Reloadable, opts ...ProviderOption) {
+	DefaultStore.RegisterReloadableProvider(name, p, opts...)
 }
 
 // UnregisterProvider unregisters a provider
@@ -45,23 +58,30 @@ func ErrorProvider(name string, err error) {
 }
 
 // File registers a configstore provider which reads from the file given in parameter (static content).
-func File(filename string) {
-	DefaultStore.File(filename)
+func File(filename string, opts ...ProviderOption) {
+	DefaultStore.File(filename, opts...)
 }
 
 // FileRefresh registers a configstore provider which readfs from the file given in parameter (provider watches file stat for auto refresh, watchers get notified).
-func FileRefresh(filename string) {
-	DefaultStore.FileRefresh(filename)
+// If filesystem notifications are not available for that file, the provider falls back to polling (see FilePoll).
+func FileRefresh(filename string, opts ...ProviderOption) {
+	DefaultStore.FileRefresh(filename, opts...)
+}
+
+// FilePoll registers a configstore provider which reads from the file given in parameter (provider polls file stat and content
+// at the given interval for auto refresh, watchers get notified). This is suitable for filesystems without notification support (NFS, ...).
+func FilePoll(filename string, interval time.Duration, opts ...ProviderOption) {
+	DefaultStore.FilePoll(filename, interval, opts...)
 }
 
 // FileCustom registers a configstore provider which reads from the file given in parameter, and loads the content using the given unmarshal function
-func FileCustom(filename string, fn func([]byte) ([]Item, error)) {
-	DefaultStore.FileCustom(filename, fn)
+func FileCustom(filename string, fn func([]byte) ([]Item, error), opts ...ProviderOption) {
+	DefaultStore.FileCustom(filename, fn, opts...)
 }
 
 // FileCustomRefresh registers a configstore provider which reads from the file given in parameter, and loads the content using the given unmarshal function; and watches file stat for auto refresh
-func FileCustomRefresh(filename string, fn func([]byte) ([]Item, error)) {
-	DefaultStore.FileCustomRefresh(filename, fn)
+func FileCustomRefresh(filename string, fn func([]byte) ([]Item, error), opts ...ProviderOption) {
+	DefaultStore.FileCustomRefresh(filename, fn, opts...)
 }
 
 // FileTree registers a configstore provider which reads from the files contained in the directory given in parameter.
@@ -70,40 +90,91 @@ func FileCustomRefresh(filename string, fn func([]byte) ([]Item, error)) {
 // The content of the files should be the plain data, with no envelope.
 // Capitalization can be used to indicate item priority for sub-directories containing multiple items which should be differentiated.
 // Capitalized = higher priority.
-func FileTree(dirname string) {
-	DefaultStore.FileTree(dirname)
+// Explicit priority, sensitivity, content encoding (raw or base64) and description can be set for a file or sub-directory
+// with a "<name>.meta.yaml" sidecar file, or for a whole directory with a ".configstore.yaml" file.
+func FileTree(dirname string, opts ...ProviderOption) {
+	DefaultStore.FileTree(dirname, opts...)
 }
 
 // FileTreeRefresh is similar to the FileTree provider with the refresh feature enabled.
 // Updates can be handled with the `Watch()` function.
-func FileTreeRefresh(dirname string) {
-	DefaultStore.FileTreeRefresh(dirname)
+func FileTreeRefresh(dirname string, opts ...ProviderOption) {
+	DefaultStore.FileTreeRefresh(dirname, opts...)
+}
+
+// FileTreePoll is similar to the FileTree provider with the refresh feature enabled, using polling at the given interval
+// instead of filesystem notifications.
+// Updates can be handled with the `Watch()` function.
+func FileTreePoll(dirname string, interval time.Duration, opts ...ProviderOption) {
+	DefaultStore.FileTreePoll(dirname, interval, opts...)
 }
 
 // FileList registers a configstore provider which reads from the files contained in the directory given in parameter.
 // The content of the files should be JSON/YAML similar to the File provider.
-func FileList(dirname string) {
-	DefaultStore.FileList(dirname)
+func FileList(dirname string, opts ...ProviderOption) {
+	DefaultStore.FileList(dirname, opts...)
 }
 
 // FileListRefresh is similar to the FileList provider with the refresh feature enabled.
 // Updates can be handled with the `Watch()` function.
-func FileListRefresh(dirname string) {
-	DefaultStore.FileListRefresh(dirname)
+func FileListRefresh(dirname string, opts ...ProviderOption) {
+	DefaultStore.FileListRefresh(dirname, opts...)
+}
+
+// FileListPoll is similar to the FileList provider with the refresh feature enabled, using polling at the given interval
+// instead of filesystem notifications.
+// Updates can be handled with the `Watch()` function.
+func FileListPoll(dirname string, interval time.Duration, opts ...ProviderOption) {
+	DefaultStore.FileListPoll(dirname, interval, opts...)
+}
+
+// HTTP registers a configstore provider which fetches a document from the given URL (static content).
+func HTTP(url string, cfg HTTPConfig, opts ...ProviderOption) {
+	DefaultStore.HTTP(url, cfg, opts...)
+}
+
+// HTTPRefresh is similar to HTTPPoll, using DefaultPollInterval.
+func HTTPRefresh(url string, cfg HTTPConfig, opts ...ProviderOption) {
+	DefaultStore.HTTPRefresh(url, cfg, opts...)
+}
+
+// HTTPPoll registers a configstore provider which fetches a document from the given URL, and polls it at the given interval
+// for auto refresh (watchers get notified when the content changes).
+func HTTPPoll(url string, cfg HTTPConfig, interval time.Duration, opts ...ProviderOption) {
+	DefaultStore.HTTPPoll(url, cfg, interval, opts...)
 }
 
 // InMemory registers an InMemoryProvider with a given arbitrary name and returns it.
 // You can append any number of items to it, see Add().
-func InMemory(name string) *InMemoryProvider {
-	return DefaultStore.InMemory(name)
+func InMemory(name string, opts ...ProviderOption) *InMemoryProvider {
+	return DefaultStore.InMemory(name, opts...)
 }
 
 // Env registers a provider reading from the environment.
 // Only variables beginning with "PREFIX_" will be considered.
 // Trimmed variable names are used as keys. Keys are not case-sensitive.
 // Underscores (_) in variable names are considered equivalent to dashes (-).
-func Env(prefix string) {
-	DefaultStore.Env(prefix)
+func Env(prefix string, opts ...ProviderOption) {
+	DefaultStore.Env(prefix, opts...)
+}
+
+// Reload re-reads the sources of all the reloadable providers, then notifies the watchers once.
+// The built-in file, filelist, filetree and env providers are reloadable.
+func Reload(ctx context.Context) error {
+	return DefaultStore.Reload(ctx)
+}
+
+// ReloadOnSignal calls Reload every time one of the given signals (SIGHUP if none) is received.
+// Reload errors are logged.
+func ReloadOnSignal(sig ...os.Signal) {
+	DefaultStore.ReloadOnSignal(sig...)
+}
+
+// ProviderStatus returns the status of all the registered providers, by provider name.
+// It can be used to expose readiness probes: a provider with a non-nil LastError is serving stale
+// data (refreshing providers) or failing (GetItemList returns an error).
+func ProviderStatus() map[string]ProviderState {
+	return DefaultStore.ProviderStatus()
 }
 
 /*
@@ -140,6 +211,31 @@ func NotifyIsMuted() bool {
 	return DefaultStore.NotifyIsMuted()
 }
 
+// SetRefreshDebounce sets the delay used by the refreshing providers to coalesce bursts of change events
+// (partial writes, several files updated at once, ...) into a single reload.
+// A zero delay (the default) reloads on every event. Watchers are only notified if the reloaded items differ.
+func SetRefreshDebounce(d time.Duration) {
+	DefaultStore.SetRefreshDebounce(d)
+}
+
+// SetPersistentCache enables the on-disk cache of the last good configuration. See Store.SetPersistentCache.
+func SetPersistentCache(path string, key []byte) error {
+	return DefaultStore.SetPersistentCache(path, key)
+}
+
+// SetAmbiguityPolicy sets the policy used by GetItem (and the GetItemValue variants) to resolve several items
+// sharing the same key. The default is AmbiguityStrict.
+func SetAmbiguityPolicy(p AmbiguityPolicy) {
+	DefaultStore.SetAmbiguityPolicy(p)
+}
+
+// SetFetchConcurrency sets the maximum number of providers called concurrently by GetItemList
+// (DefaultFetchConcurrency by default). A value of 1 or less calls the providers one at a time.
+// With a higher value, the providers may be called from several goroutines, and must be goroutine-safe.
+func SetFetchConcurrency(n int) {
+	DefaultStore.SetFetchConcurrency(n)
+}
+
 /*
 ** GETTERS
  */
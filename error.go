@@ -1,22 +1,124 @@
 package configstore
 
-type ErrItemNotFound string
-type ErrUninitializedItemList string
-type ErrAmbiguousItem string
-type ErrProvider string
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Sentinel errors, to be matched with errors.Is.
+var (
+	// ErrNotFound matches ErrItemNotFound errors.
+	ErrNotFound = errors.New("configstore: item not found")
+	// ErrAmbiguous matches ErrAmbiguousItem errors.
+	ErrAmbiguous = errors.New("configstore: ambiguous item")
+	// ErrUninitialized matches ErrUninitializedItemList errors.
+	ErrUninitialized = errors.New("configstore: non-initialized item list")
+	// ErrProviderFailed matches ErrProvider and ErrProviders errors.
+	ErrProviderFailed = errors.New("configstore: provider failure")
+)
+
+// ErrItemNotFound is returned when no item matches the requested key.
+type ErrItemNotFound struct {
+	// Key is the requested key. For GetFirstItem, it is the key of the filter first slice, if any.
+	Key string
+
+	first bool
+}
+
+// ErrUninitializedItemList is returned when an item is requested from a nil item list.
+type ErrUninitializedItemList struct {
+	// Key is the requested key.
+	Key string
+}
+
+// ErrAmbiguousItem is returned, as a pointer, when several items match the requested key, and the ambiguity policy
+// does not allow to pick one of them (see AmbiguityPolicy). Since it holds the candidates, the error value itself
+// is not comparable.
+type ErrAmbiguousItem struct {
+	// Key is the requested key.
+	Key string
+	// Candidates lists the conflicting items, sorted by priority.
+	Candidates []Item
+
+	topPriority bool
+}
+
+// ErrProvider is returned when a provider fails to return its items.
+type ErrProvider struct {
+	// Provider is the name of the failing provider.
+	Provider string
+	// Err is the error returned by the provider.
+	Err error
+}
+
+// ErrProviders aggregates the errors of several failing providers, in merge order.
+type ErrProviders []ErrProvider
 
 func (e ErrItemNotFound) Error() string {
-	return string(e)
+	if e.first {
+		key := e.Key
+		if key == "" {
+			key = "[NONE]"
+		}
+		return fmt.Sprintf("configstore: get first item (slice: %s): no item found", key)
+	}
+	return fmt.Sprintf("configstore: get '%s': no item found", e.Key)
+}
+
+// Is makes errors.Is(err, ErrNotFound) match.
+func (e ErrItemNotFound) Is(target error) bool {
+	return target == ErrNotFound
 }
 
 func (e ErrUninitializedItemList) Error() string {
-	return string(e)
+	return fmt.Sprintf("configstore: get '%s': non-initialized item list", e.Key)
+}
+
+// Is makes errors.Is(err, ErrUninitialized) match.
+func (e ErrUninitializedItemList) Is(target error) bool {
+	return target == ErrUninitialized
 }
 
-func (e ErrAmbiguousItem) Error() string {
-	return string(e)
+func (e *ErrAmbiguousItem) Error() string {
+	if e.topPriority {
+		return fmt.Sprintf("configstore: get '%s': ambiguous, %d items share the highest priority", e.Key, len(e.Candidates))
+	}
+	return fmt.Sprintf("configstore: get '%s': ambiguous, %d items share that key", e.Key, len(e.Candidates))
+}
+
+// Is makes errors.Is(err, ErrAmbiguous) match.
+func (e *ErrAmbiguousItem) Is(target error) bool {
+	return target == ErrAmbiguous
 }
 
 func (e ErrProvider) Error() string {
-	return string(e)
+	return fmt.Sprintf("configstore: provider '%s': %v", e.Provider, e.Err)
+}
+
+// Is makes errors.Is(err, ErrProviderFailed) match.
+func (e ErrProvider) Is(target error) bool {
+	return target == ErrProviderFailed
+}
+
+// Unwrap returns the error returned by the provider.
+func (e ErrProvider) Unwrap() error {
+	return e.Err
+}
+
+func (e ErrProviders) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// Unwrap returns the errors of the failing providers, so that errors.Is and errors.As inspect all of them.
+func (e ErrProviders) Unwrap() []error {
+	ret := make([]error, len(e))
+	for i, err := range e {
+		ret[i] = err
+	}
+	return ret
 }
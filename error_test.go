@@ -0,0 +1,72 @@
+package configstore
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestItemErrors(t *testing.T) {
+	s := NewStore()
+	defer s.Close()
+	s.InMemory("a").Add(NewItem("foo", "a", 1))
+	s.InMemory("b").Add(NewItem("foo", "b", 2))
+
+	_, err := s.GetItem("missing")
+	assert.ErrorIs(t, err, ErrNotFound)
+	var notFound ErrItemNotFound
+	require.ErrorAs(t, err, &notFound)
+	assert.Equal(t, "missing", notFound.Key)
+	assert.EqualError(t, err, "configstore: get 'missing': no item found")
+
+	_, err = s.GetItem("foo")
+	assert.ErrorIs(t, err, ErrAmbiguous)
+	assert.NotErrorIs(t, err, ErrNotFound)
+	var ambiguous *ErrAmbiguousItem
+	require.ErrorAs(t, err, &ambiguous)
+	assert.Equal(t, "foo", ambiguous.Key)
+	require.Len(t, ambiguous.Candidates, 2)
+	assert.Equal(t, "b", ambiguous.Candidates[0].Provider())
+	assert.Equal(t, "a", ambiguous.Candidates[1].Provider())
+	// comparing the error does not panic, although it holds a slice
+	assert.NotPanics(t, func() { _ = err == error(ambiguous) })
+
+	var items *ItemList
+	_, err = items.GetItem("foo")
+	assert.ErrorIs(t, err, ErrUninitialized)
+
+	_, err = Filter().Slice("missing").Store(s).GetFirstItem()
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.EqualError(t, err, "configstore: get first item (slice: missing): no item found")
+}
+
+func TestProviderErrors(t *testing.T) {
+	errA := errors.New("a is broken")
+	errB := errors.New("b is broken")
+
+	s := NewStore()
+	defer s.Close()
+	s.InMemory("ok").Add(NewItem("foo", "bar", 0))
+	s.ErrorProvider("a", errA)
+
+	_, err := s.GetItemList()
+	assert.ErrorIs(t, err, ErrProviderFailed)
+	assert.ErrorIs(t, err, errA)
+	var provErr ErrProvider
+	require.ErrorAs(t, err, &provErr)
+	assert.Equal(t, "a", provErr.Provider)
+	assert.EqualError(t, err, "configstore: provider 'a': a is broken")
+
+	s.ErrorProvider("b", errB)
+	_, err = s.GetItemValue("foo")
+	assert.ErrorIs(t, err, ErrProviderFailed)
+	assert.ErrorIs(t, err, errA)
+	assert.ErrorIs(t, err, errB)
+	var provErrs ErrProviders
+	require.ErrorAs(t, err, &provErrs)
+	require.Len(t, provErrs, 2)
+	assert.Equal(t, "a", provErrs[0].Provider)
+	assert.Equal(t, "b", provErrs[1].Provider)
+}
@@ -0,0 +1,392 @@
+// Package etcd provides a configstore provider reading the keys under an etcd v3 prefix.
+//
+// The provider talks to the JSON gateway of etcd (the /v3 HTTP endpoints served next to the gRPC API), so that it does
+// not depend on the etcd client module. Each key under the prefix becomes an item, named after the key relative to the prefix.
+//
+// Importing the package registers the "etcd" provider factory:
+//
+//	CONFIGURATION_FROM=etcd:/myapp/?refresh=true&endpoint=http://etcd-1:2379&endpoint=http://etcd-2:2379
+//
+// The refreshing variant watches the prefix, applies the changes incrementally and notifies the watchers.
+// When the watch breaks, it reconnects (trying the next endpoint) and resumes from the last seen revision,
+// or reloads the whole prefix if that revision was compacted.
+package etcd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ovh/configstore"
+)
+
+func init() {
+	for _, refresh := range []bool{false, true} {
+		name := "etcd"
+		if refresh {
+			name += "+refresh"
+		}
+		configstore.RegisterProviderFactoryInfo(configstore.ProviderFactoryInfo{
+			Name:        name,
+			Description: "Reads the keys under an etcd v3 prefix.",
+			Syntax:      name + ":<prefix>",
+			Examples:    []string{name + ":/myapp/?endpoint=http://etcd.internal:2379"},
+			Options:     []string{"endpoint", "username", "password-file", "retry-delay"},
+			Factory:     factory(refresh),
+		})
+	}
+}
+
+const (
+	// DefaultEndpoint is the etcd endpoint, when neither Config.Endpoints nor ETCDCTL_ENDPOINTS are set.
+	DefaultEndpoint = "http://127.0.0.1:2379"
+	// DefaultRetryDelay is the default delay before reconnecting, after a failure.
+	DefaultRetryDelay = time.Second
+)
+
+// errCompacted is returned by watch when the requested revision has been compacted.
+var errCompacted = errors.New("required revision has been compacted")
+
+// Config configures the etcd provider, see Register.
+type Config struct {
+	// Endpoints are the URLs of the etcd members (ETCDCTL_ENDPOINTS, or DefaultEndpoint by default).
+	// The next one is tried after each failure.
+	Endpoints []string
+	// Username and Password enable the etcd authentication.
+	Username string
+	Password string
+	// PasswordFile is the path of a file holding the password, read at each authentication.
+	PasswordFile string
+	// HTTPClient is the client used for the requests (http.DefaultClient by default). It must not have a timeout,
+	// since watches are long-lived requests.
+	HTTPClient *http.Client
+	// Priority is the priority of the items.
+	Priority int64
+	// Watch follows the changes of the prefix, and notifies the watchers.
+	Watch bool
+	// RetryDelay is the delay before reconnecting after a failure (DefaultRetryDelay by default).
+	RetryDelay time.Duration
+}
+
+func factory(refresh bool) configstore.ProviderFactoryFunc {
+	return func(s *configstore.Store, spec configstore.ProviderSpec) error {
+		cfg := Config{
+			Endpoints:    spec.Options["endpoint"],
+			Username:     spec.Option("username"),
+			PasswordFile: spec.Option("password-file"),
+			Watch:        refresh,
+		}
+		var err error
+		cfg.RetryDelay, err = spec.DurationOption("retry-delay", 0)
+		if err != nil {
+			s.ErrorProvider("etcd:"+spec.Arg, err)
+			return err
+		}
+		return Register(s, spec.Arg, cfg, spec.ProviderOptions()...)
+	}
+}
+
+// Payloads of the JSON gateway. Bytes are base64 encoded, and 64-bit integers are strings.
+type (
+	header struct {
+		Revision int64 `json:"revision,string"`
+	}
+	keyValue struct {
+		Key   []byte `json:"key"`
+		Value []byte `json:"value"`
+	}
+	rangeRequest struct {
+		Key      []byte `json:"key"`
+		RangeEnd []byte `json:"range_end"`
+	}
+	rangeResponse struct {
+		Header header     `json:"header"`
+		Kvs    []keyValue `json:"kvs"`
+	}
+	watchCreateRequest struct {
+		Key           []byte `json:"key"`
+		RangeEnd      []byte `json:"range_end"`
+		StartRevision int64  `json:"start_revision,string"`
+	}
+	watchEvent struct {
+		Type string   `json:"type"` // "PUT" is the default value, and may be omitted
+		Kv   keyValue `json:"kv"`
+	}
+	watchResponse struct {
+		Header          header       `json:"header"`
+		Created         bool         `json:"created"`
+		Canceled        bool         `json:"canceled"`
+		CompactRevision int64        `json:"compact_revision,string"`
+		CancelReason    string       `json:"cancel_reason"`
+		Events          []watchEvent `json:"events"`
+	}
+	gatewayError struct {
+		Message string `json:"message"`
+	}
+)
+
+// client keeps a local copy of the keys under a prefix.
+type client struct {
+	*configstore.Remote
+	prefix string
+	cfg    Config
+
+	// only used by the goroutine loading and watching the prefix
+	endpoint int
+	token    string
+	values   map[string]string
+	revision int64
+}
+
+// Register registers a provider reading the keys under the given etcd prefix, named "etcd:<prefix>".
+// If cfg.Watch is set, the provider watches the prefix until the store is closed, and the watchers get notified
+// when the items change (see configstore.Remote for the handling of failures).
+func Register(s *configstore.Store, prefix string, cfg Config, opts ...configstore.ProviderOption) error {
+	if len(cfg.Endpoints) == 0 && os.Getenv("ETCDCTL_ENDPOINTS") != "" {
+		cfg.Endpoints = strings.Split(os.Getenv("ETCDCTL_ENDPOINTS"), ",")
+	}
+	if len(cfg.Endpoints) == 0 {
+		cfg.Endpoints = []string{DefaultEndpoint}
+	}
+	endpoints := make([]string, len(cfg.Endpoints))
+	for i, e := range cfg.Endpoints {
+		if !strings.Contains(e, "://") {
+			e = "http://" + e
+		}
+		endpoints[i] = strings.TrimSuffix(e, "/")
+	}
+	cfg.Endpoints = endpoints
+	if cfg.HTTPClient == nil {
+		cfg.HTTPClient = http.DefaultClient
+	}
+	if cfg.RetryDelay <= 0 {
+		cfg.RetryDelay = DefaultRetryDelay
+	}
+	c := &client{Remote: s.NewRemote("etcd:" + prefix), prefix: prefix, cfg: cfg}
+
+	err := c.authenticate(c.Context())
+	if err == nil {
+		err = c.load(c.Context())
+	}
+	loaded := err == nil
+	if loaded {
+		c.Set(c.items()...)
+	}
+	err = c.Register(err, cfg.Watch, opts...)
+	if cfg.Watch {
+		go c.follow(c.Context(), loaded)
+	}
+	return err
+}
+
+// follow watches the prefix, reconnecting after failures, until ctx is done.
+func (c *client) follow(ctx context.Context, loaded bool) {
+	for ctx.Err() == nil {
+		err := c.authenticate(ctx)
+		if err == nil && !loaded {
+			err = c.load(ctx)
+			if err == nil {
+				loaded = true
+				c.Update(c.items()...)
+			}
+		}
+		if err == nil {
+			err = c.watch(ctx)
+		}
+		switch {
+		case ctx.Err() != nil:
+			return
+		case errors.Is(err, errCompacted):
+			// the changes since the last seen revision are lost: reload the prefix
+			loaded = false
+		default:
+			c.Fail(err)
+			c.endpoint = (c.endpoint + 1) % len(c.cfg.Endpoints)
+			select {
+			case <-ctx.Done():
+			case <-time.After(c.cfg.RetryDelay):
+			}
+		}
+	}
+}
+
+// load reads all the keys under the prefix.
+func (c *client) load(ctx context.Context) error {
+	key, end := c.keyRange()
+	var resp rangeResponse
+	if err := c.post(ctx, "/v3/kv/range", rangeRequest{Key: key, RangeEnd: end}, &resp); err != nil {
+		return err
+	}
+	c.values = make(map[string]string, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		c.values[string(kv.Key)] = string(kv.Value)
+	}
+	c.revision = resp.Header.Revision
+	return nil
+}
+
+// watch follows the changes after the last seen revision. It only returns on failure.
+func (c *client) watch(ctx context.Context) error {
+	key, end := c.keyRange()
+	req := map[string]watchCreateRequest{
+		"create_request": {Key: key, RangeEnd: end, StartRevision: c.revision + 1},
+	}
+	body, err := c.do(ctx, "/v3/watch", req)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	dec := json.NewDecoder(body)
+	for {
+		var msg struct {
+			Result *watchResponse `json:"result"`
+			Error  *gatewayError  `json:"error"`
+		}
+		if err := dec.Decode(&msg); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return fmt.Errorf("etcd: %s: watch: %w", c.prefix, err)
+		}
+		if msg.Error != nil {
+			return fmt.Errorf("etcd: %s: watch: %s", c.prefix, msg.Error.Message)
+		}
+		r := msg.Result
+		if r == nil {
+			continue
+		}
+		if r.CompactRevision > 0 {
+			return fmt.Errorf("etcd: %s: watch: %w (revision %d)", c.prefix, errCompacted, r.CompactRevision)
+		}
+		if r.Canceled {
+			return fmt.Errorf("etcd: %s: watch canceled: %s", c.prefix, r.CancelReason)
+		}
+		if r.Created {
+			// the provider recovers once the watch is set up again
+			c.Update(c.items()...)
+		}
+		if len(r.Events) == 0 {
+			continue
+		}
+		for _, ev := range r.Events {
+			if ev.Type == "DELETE" {
+				delete(c.values, string(ev.Kv.Key))
+			} else {
+				c.values[string(ev.Kv.Key)] = string(ev.Kv.Value)
+			}
+		}
+		c.revision = r.Header.Revision
+		c.Update(c.items()...)
+	}
+}
+
+// items builds the items from the local copy of the keys.
+func (c *client) items() []configstore.Item {
+	keys := make([]string, 0, len(c.values))
+	for k := range c.values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	items := make([]configstore.Item, 0, len(keys))
+	for _, k := range keys {
+		name := strings.TrimPrefix(strings.TrimPrefix(k, c.prefix), "/")
+		if name == "" {
+			continue
+		}
+		items = append(items, configstore.NewItem(name, c.values[k], c.cfg.Priority))
+	}
+	return items
+}
+
+// keyRange returns the key range matching the prefix.
+func (c *client) keyRange() ([]byte, []byte) {
+	if c.prefix == "" {
+		// all the keys
+		return []byte{0}, []byte{0}
+	}
+	end := []byte(c.prefix)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return []byte(c.prefix), end[:i+1]
+		}
+	}
+	// the prefix only holds 0xff bytes: no upper bound
+	return []byte(c.prefix), []byte{0}
+}
+
+// authenticate obtains a token, if the authentication is enabled.
+func (c *client) authenticate(ctx context.Context) error {
+	if c.cfg.Username == "" {
+		return nil
+	}
+	password := c.cfg.Password
+	if c.cfg.PasswordFile != "" {
+		b, err := os.ReadFile(c.cfg.PasswordFile)
+		if err != nil {
+			return err
+		}
+		password = strings.TrimSpace(string(b))
+	}
+	c.token = ""
+	var resp struct {
+		Token string `json:"token"`
+	}
+	if err := c.post(ctx, "/v3/auth/authenticate", map[string]string{"name": c.cfg.Username, "password": password}, &resp); err != nil {
+		return err
+	}
+	c.token = resp.Token
+	return nil
+}
+
+// post calls an endpoint of the gateway, and decodes the response into out.
+func (c *client) post(ctx context.Context, endpoint string, in, out any) error {
+	body, err := c.do(ctx, endpoint, in)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+	if err := json.NewDecoder(body).Decode(out); err != nil {
+		return fmt.Errorf("etcd: %s: %s: %w", c.prefix, endpoint, err)
+	}
+	return nil
+}
+
+// do calls an endpoint of the gateway on the current etcd member, and returns the response body.
+func (c *client) do(ctx context.Context, endpoint string, in any) (io.ReadCloser, error) {
+	b, err := json.Marshal(in)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.cfg.Endpoints[c.endpoint]+endpoint, bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.token != "" {
+		req.Header.Set("Authorization", c.token)
+	}
+	resp, err := c.cfg.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		msg := resp.Status
+		var gwErr gatewayError
+		if json.NewDecoder(resp.Body).Decode(&gwErr) == nil && gwErr.Message != "" {
+			msg += ": " + gwErr.Message
+		}
+		return nil, fmt.Errorf("etcd: %s: %s: %s", c.prefix, endpoint, msg)
+	}
+	return resp.Body, nil
+}
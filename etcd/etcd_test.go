@@ -0,0 +1,301 @@
+package etcd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ovh/configstore"
+	"github.com/ovh/configstore/internal/storetest"
+)
+
+// fakeEtcd mimics the range, watch and authenticate endpoints of the etcd JSON gateway.
+type fakeEtcd struct {
+	mut       sync.Mutex
+	values    map[string]string
+	history   []fakeEvent
+	revision  int64
+	compacted int64
+	changed   chan struct{}
+	drop      chan struct{}
+	ranges    int
+	down      bool
+	token     string
+}
+
+type fakeEvent struct {
+	revision int64
+	event    watchEvent
+}
+
+func newFakeEtcd() *fakeEtcd {
+	return &fakeEtcd{values: map[string]string{}, revision: 1, changed: make(chan struct{}), drop: make(chan struct{})}
+}
+
+func (f *fakeEtcd) put(key, value string) {
+	f.record(watchEvent{Kv: keyValue{Key: []byte(key), Value: []byte(value)}})
+}
+
+func (f *fakeEtcd) delete(key string) {
+	f.record(watchEvent{Type: "DELETE", Kv: keyValue{Key: []byte(key)}})
+}
+
+func (f *fakeEtcd) record(ev watchEvent) {
+	f.mut.Lock()
+	defer f.mut.Unlock()
+	f.revision++
+	if ev.Type == "DELETE" {
+		delete(f.values, string(ev.Kv.Key))
+	} else {
+		f.values[string(ev.Kv.Key)] = string(ev.Kv.Value)
+	}
+	f.history = append(f.history, fakeEvent{revision: f.revision, event: ev})
+	close(f.changed)
+	f.changed = make(chan struct{})
+}
+
+// compact drops the history, so that watches from older revisions get canceled.
+func (f *fakeEtcd) compact() {
+	f.mut.Lock()
+	defer f.mut.Unlock()
+	f.compacted = f.revision
+	f.history = nil
+}
+
+// disconnect breaks the running watches, and makes the next ones fail until reconnect is called.
+func (f *fakeEtcd) disconnect() {
+	f.mut.Lock()
+	defer f.mut.Unlock()
+	f.down = true
+	close(f.drop)
+	f.drop = make(chan struct{})
+}
+
+func (f *fakeEtcd) reconnect() {
+	f.mut.Lock()
+	defer f.mut.Unlock()
+	f.down = false
+}
+
+func inRange(key string, r rangeRequest) bool {
+	return key >= string(r.Key) && (bytes.Equal(r.RangeEnd, []byte{0}) || key < string(r.RangeEnd))
+}
+
+func (f *fakeEtcd) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/v3/auth/authenticate":
+		var req map[string]string
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		if req["name"] != "root" || req["password"] != "pass" {
+			w.WriteHeader(http.StatusUnauthorized)
+			_ = json.NewEncoder(w).Encode(gatewayError{Message: "etcdserver: authentication failed, invalid user ID or password"})
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]string{"token": "tok"})
+
+	case "/v3/kv/range":
+		var req rangeRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		f.mut.Lock()
+		f.token = r.Header.Get("Authorization")
+		f.ranges++
+		resp := map[string]any{"header": map[string]string{"revision": strconv.FormatInt(f.revision, 10)}}
+		var kvs []keyValue
+		for k, v := range f.values {
+			if inRange(k, req) {
+				kvs = append(kvs, keyValue{Key: []byte(k), Value: []byte(v)})
+			}
+		}
+		f.mut.Unlock()
+		if len(kvs) > 0 {
+			resp["kvs"] = kvs
+		}
+		_ = json.NewEncoder(w).Encode(resp)
+
+	case "/v3/watch":
+		var req struct {
+			CreateRequest watchCreateRequest `json:"create_request"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		f.serveWatch(w, r, req.CreateRequest)
+
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (f *fakeEtcd) serveWatch(w http.ResponseWriter, r *http.Request, req watchCreateRequest) {
+	send := func(result map[string]any) {
+		_ = json.NewEncoder(w).Encode(map[string]any{"result": result})
+		w.(http.Flusher).Flush()
+	}
+	f.mut.Lock()
+	if f.down {
+		f.mut.Unlock()
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	if req.StartRevision <= f.compacted {
+		f.mut.Unlock()
+		send(map[string]any{"canceled": true, "compact_revision": strconv.FormatInt(f.compacted, 10)})
+		return
+	}
+	send(map[string]any{"created": true, "header": map[string]string{"revision": strconv.FormatInt(f.revision, 10)}})
+	next := req.StartRevision
+	for {
+		var events []watchEvent
+		for _, ev := range f.history {
+			if ev.revision >= next && inRange(string(ev.event.Kv.Key), rangeRequest{Key: req.Key, RangeEnd: req.RangeEnd}) {
+				events = append(events, ev.event)
+			}
+		}
+		next = f.revision + 1
+		if len(events) > 0 {
+			send(map[string]any{"events": events, "header": map[string]string{"revision": strconv.FormatInt(f.revision, 10)}})
+		}
+		changed, drop := f.changed, f.drop
+		f.mut.Unlock()
+		select {
+		case <-changed:
+		case <-drop:
+			return
+		case <-r.Context().Done():
+			return
+		}
+		f.mut.Lock()
+	}
+}
+
+func getValue(t *testing.T, s *configstore.Store, key string) string {
+	t.Helper()
+	v, err := s.GetItemValue(key)
+	require.NoError(t, err)
+	return v
+}
+
+func TestEtcdProvider(t *testing.T) {
+	fake := newFakeEtcd()
+	fake.put("/myapp/db/url", "postgres://db")
+	fake.put("/myapp/port", "8080")
+	fake.put("/other/key", "x")
+	ts := httptest.NewServer(fake)
+	defer ts.Close()
+
+	s := configstore.NewStore()
+	defer s.Close()
+	require.NoError(t, Register(s, "/myapp/", Config{Endpoints: []string{ts.URL}, Username: "root", Password: "pass", Priority: 2}))
+	assert.Equal(t, "tok", fake.token)
+
+	items, err := s.GetItemList()
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"db/url", "port"}, items.Keys())
+	i, err := items.GetItem("port")
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), i.Priority())
+	assert.Equal(t, "etcd:/myapp/", i.Provider())
+
+	// bad credentials register a failing provider
+	s = configstore.NewStore()
+	defer s.Close()
+	assert.Error(t, Register(s, "/myapp/", Config{Endpoints: []string{ts.URL}, Username: "root", Password: "nope"}))
+	_, err = s.GetItemList()
+	assert.Error(t, err)
+}
+
+func TestEtcdProviderWatch(t *testing.T) {
+	fake := newFakeEtcd()
+	fake.put("/myapp/foo", "bar")
+	fake.put("/myapp/gone", "soon")
+	ts := httptest.NewServer(fake)
+	defer ts.Close()
+
+	s := configstore.NewStore()
+	defer s.Close()
+	ch := s.Watch()
+	cfg := Config{Endpoints: []string{ts.URL}, Watch: true, RetryDelay: 10 * time.Millisecond}
+	require.NoError(t, Register(s, "/myapp/", cfg))
+	storetest.WaitNotification(t, ch)
+
+	// changes are applied incrementally
+	fake.put("/myapp/foo", "baz")
+	storetest.WaitNotification(t, ch)
+	assert.Equal(t, "baz", getValue(t, s, "foo"))
+	fake.delete("/myapp/gone")
+	storetest.WaitNotification(t, ch)
+	_, err := s.GetItem("gone")
+	assert.ErrorIs(t, err, configstore.ErrNotFound)
+
+	// changes made while disconnected are replayed from the last seen revision
+	fake.disconnect()
+	fake.put("/myapp/foo", "reconnected")
+	fake.reconnect()
+	storetest.WaitNotification(t, ch)
+	assert.Equal(t, "reconnected", getValue(t, s, "foo"))
+	fake.mut.Lock()
+	assert.Equal(t, 1, fake.ranges)
+	fake.mut.Unlock()
+
+	// if the last seen revision was compacted, the prefix is reloaded
+	fake.disconnect()
+	fake.put("/myapp/foo", "compacted")
+	fake.compact()
+	fake.reconnect()
+	storetest.WaitNotification(t, ch)
+	assert.Equal(t, "compacted", getValue(t, s, "foo"))
+	fake.mut.Lock()
+	assert.Equal(t, 2, fake.ranges)
+	fake.mut.Unlock()
+}
+
+// TestEtcdServer runs against the etcd server at CONFIGSTORE_TEST_ETCD_ENDPOINT (e.g. http://127.0.0.1:2379),
+// under a prefix of its own, which it deletes.
+func TestEtcdServer(t *testing.T) {
+	endpoint := os.Getenv("CONFIGSTORE_TEST_ETCD_ENDPOINT")
+	if endpoint == "" {
+		t.Skip("CONFIGSTORE_TEST_ETCD_ENDPOINT is not set")
+	}
+	prefix := "/configstore-test/" + strconv.FormatInt(time.Now().UnixNano(), 10) + "/"
+	admin := &client{prefix: prefix, cfg: Config{Endpoints: []string{endpoint}, HTTPClient: http.DefaultClient}}
+	put := func(key, value string) {
+		t.Helper()
+		require.NoError(t, admin.post(context.Background(), "/v3/kv/put", keyValue{Key: []byte(prefix + key), Value: []byte(value)}, &struct{}{}))
+	}
+	del := func(key string) {
+		t.Helper()
+		require.NoError(t, admin.post(context.Background(), "/v3/kv/deleterange", map[string][]byte{"key": []byte(prefix + key)}, &struct{}{}))
+	}
+	t.Cleanup(func() {
+		key, end := admin.keyRange()
+		_ = admin.post(context.Background(), "/v3/kv/deleterange", rangeRequest{Key: key, RangeEnd: end}, &struct{}{})
+	})
+	put("foo", "bar")
+	put("gone", "soon")
+
+	s := configstore.NewStore()
+	defer s.Close()
+	ch := s.Watch()
+	require.NoError(t, Register(s, prefix, Config{Endpoints: []string{endpoint}, Watch: true}))
+	storetest.WaitNotification(t, ch)
+	items, err := s.GetItemList()
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"foo", "gone"}, items.Keys())
+	assert.Equal(t, "bar", getValue(t, s, "foo"))
+
+	put("foo", "baz")
+	storetest.WaitNotification(t, ch)
+	assert.Equal(t, "baz", getValue(t, s, "foo"))
+	del("gone")
+	storetest.WaitNotification(t, ch)
+	_, err = s.GetItem("gone")
+	assert.ErrorIs(t, err, configstore.ErrNotFound)
+}
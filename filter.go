@@ -16,6 +16,7 @@ type ItemFilter struct {
 	initialKeySlice string
 	unmarshalType   interface{}
 	store           *Store
+	ambiguityPolicy *AmbiguityPolicy
 }
 
 // Filter creates a new empty filter object.
@@ -76,11 +77,7 @@ func (s *ItemFilter) GetFirstItem() (Item, error) {
 		return Item{}, err
 	}
 	if len(items.Items) == 0 {
-		sliceKey := s.initialKeySlice
-		if sliceKey == "" {
-			sliceKey = "[NONE]"
-		}
-		return Item{}, ErrItemNotFound(fmt.Sprintf("configstore: get first item (slice: %s): no item found", sliceKey))
+		return Item{}, ErrItemNotFound{Key: s.initialKeySlice, first: true}
 	}
 	return items.Items[0], nil
 }
@@ -164,10 +161,19 @@ func (s *ItemFilter) Apply(items *ItemList) *ItemList {
 	if s == nil {
 		return items
 	}
+	policy := items.policy
+	if s.ambiguityPolicy != nil {
+		policy = *s.ambiguityPolicy
+	}
 	filtered := items
 	for _, f := range s.funcs {
 		filtered = f(filtered)
 	}
+	if filtered.policy != policy {
+		ret := *filtered
+		ret.policy = policy
+		filtered = &ret
+	}
 	return filtered
 }
 
@@ -184,6 +190,7 @@ func copyItemFilter(s *ItemFilter) *ItemFilter {
 		ret.unmarshalType = s.unmarshalType
 		ret.initialKeySlice = s.initialKeySlice
 		ret.store = s.store
+		ret.ambiguityPolicy = s.ambiguityPolicy
 	}
 	return ret
 }
@@ -230,13 +237,9 @@ func (s *ItemFilter) Slice(key string, keyF ...func(string) string) *ItemFilter
 // is used as the new key.
 func (s *ItemFilter) Rekey(rekeyF func(*Item) string) *ItemFilter {
 	return s.mapFunc(func(sec *Item) Item {
-		return Item{
-			key:          transformKey(rekeyF(sec)),
-			value:        sec.value,
-			priority:     sec.priority,
-			unmarshaled:  sec.unmarshaled,
-			unmarshalErr: sec.unmarshalErr,
-		}
+		ret := *sec
+		ret.key = transformKey(rekeyF(sec))
+		return ret
 	})
 }
 
@@ -244,13 +247,9 @@ func (s *ItemFilter) Rekey(rekeyF func(*Item) string) *ItemFilter {
 // is used as the new priority.
 func (s *ItemFilter) Reorder(reorderF func(*Item) int64) *ItemFilter {
 	return s.mapFunc(func(sec *Item) Item {
-		return Item{
-			key:          sec.key,
-			value:        sec.value,
-			priority:     reorderF(sec),
-			unmarshaled:  sec.unmarshaled,
-			unmarshalErr: sec.unmarshalErr,
-		}
+		ret := *sec
+		ret.priority = reorderF(sec)
+		return ret
 	})
 }
 
@@ -262,13 +261,10 @@ func (s *ItemFilter) Transform(transformF func(*Item) (string, error)) *ItemFilt
 			return *sec
 		}
 		tr, err := transformF(sec)
-		return Item{
-			key:          sec.key,
-			value:        tr,
-			priority:     sec.priority,
-			unmarshaled:  sec.unmarshaled,
-			unmarshalErr: err,
-		}
+		ret := *sec
+		ret.value = tr
+		ret.unmarshalErr = err
+		return ret
 	})
 }
 
@@ -323,15 +319,9 @@ func (s *ItemFilter) Squash() *ItemFilter {
 
 	s.funcs = append(s.funcs, func(s *ItemList) *ItemList {
 		ret := &ItemList{}
-		for _, l := range s.indexed {
-			highest := int64(0)
-			if len(l) > 0 {
-				highest = l[0].priority
-			}
-			for _, sec := range l {
-				if sec.priority >= highest {
-					ret.Items = append(ret.Items, sec)
-				}
+		for _, sec := range s.Items {
+			if l := s.indexed[sec.key]; len(l) > 0 && sec.priority >= l[0].priority {
+				ret.Items = append(ret.Items, sec)
 			}
 		}
 		return ret.index()
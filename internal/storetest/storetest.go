@@ -0,0 +1,19 @@
+// Package storetest provides helpers shared by the tests of configstore and of its providers.
+package storetest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// WaitNotification waits for a notification on a watch channel, and fails the test after 5 seconds.
+func WaitNotification(t *testing.T, ch chan struct{}) {
+	t.Helper()
+	select {
+	case <-ch:
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "no notification has been sent")
+	}
+}
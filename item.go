@@ -16,6 +16,11 @@ type Item struct {
 	key          string
 	value        string
 	priority     int64
+	sensitive    bool
+	description  string
+	provider     string
+	origin       int
+	stale        bool
 	unmarshaled  interface{}
 	unmarshalErr error
 }
@@ -125,6 +130,33 @@ func (s Item) Priority() int64 {
 	return s.priority
 }
 
+// Sensitive reports whether the provider flagged the item value as sensitive (secrets, credentials, ...).
+func (s Item) Sensitive() bool {
+	return s.sensitive
+}
+
+// Description returns the optional description attached to the item by its provider.
+func (s Item) Description() string {
+	return s.description
+}
+
+// WithSensitive returns a copy of the item, flagged as sensitive or not. It is meant to be used by provider implementations.
+func (s Item) WithSensitive(sensitive bool) Item {
+	s.sensitive = sensitive
+	return s
+}
+
+// Provider returns the name of the provider which returned the item, when the item list was built by a store.
+func (s Item) Provider() string {
+	return s.provider
+}
+
+// Stale reports whether the item was served from the persistent cache, because its provider failed.
+// See Store.SetPersistentCache.
+func (s Item) Stale() bool {
+	return s.stale
+}
+
 // Tries to unmarshal (from JSON or YAML) the item value into i.
 // The result and error are stored within the item object, to be handled later.
 func (s *Item) storeUnmarshal(i interface{}) {
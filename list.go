@@ -1,7 +1,6 @@
 package configstore
 
 import (
-	"fmt"
 	"sort"
 	"time"
 )
@@ -10,40 +9,39 @@ import (
 type ItemList struct {
 	Items   []Item
 	indexed map[string][]Item
+	policy  AmbiguityPolicy
 }
 
-// Keys returns a list of the different keys present in the item list.
+// Keys returns a list of the different keys present in the item list, in the order of the items.
 func (s *ItemList) Keys() []string {
 	if s == nil {
 		return nil
 	}
 
 	ret := []string{}
-	for k := range s.indexed {
-		ret = append(ret, k)
+	seen := map[string]bool{}
+	for _, it := range s.Items {
+		if !seen[it.key] {
+			seen[it.key] = true
+			ret = append(ret, it.key)
+		}
 	}
 
 	return ret
 }
 
 // GetItem returns a single item, by key.
-// If 0 or >=2 items are present with that key, it will return an error.
+// If 0 or >=2 items are present with that key, it will return an error,
+// unless the list ambiguity policy resolves it (see AmbiguityPolicy).
 func (s *ItemList) GetItem(key string) (Item, error) {
 
 	if s == nil {
-		return Item{}, ErrUninitializedItemList(fmt.Sprintf("configstore: get '%s': non-initialized item list", key))
+		return Item{}, ErrUninitializedItemList{Key: key}
 	}
 
 	l := (&ItemFilter{}).Slice(key).Apply(s)
 
-	switch len(l.Items) {
-	case 0:
-		return Item{}, ErrItemNotFound(fmt.Sprintf("configstore: get '%s': no item found", key))
-	case 1:
-		return l.Items[0], nil
-
-	}
-	return Item{}, ErrAmbiguousItem(fmt.Sprintf("configstore: get '%s': ambiguous, %d items share that key", key, len(l.Items)))
+	return s.policy.resolve(key, l.Items)
 }
 
 // GetItemValue returns a single item value, by key.
@@ -130,11 +128,12 @@ func (s *ItemList) Swap(i, j int) {
 }
 
 // Indexes the items of the list by key for easy access.
+// Items are stable sorted by priority, so items sharing the same priority keep their merge order.
 func (s *ItemList) index() *ItemList {
 	if s.indexed != nil {
 		return s
 	}
-	sort.Sort(s)
+	sort.Stable(s)
 	s.indexed = map[string][]Item{}
 	for _, sec := range s.Items {
 		s.indexed[sec.key] = append(s.indexed[sec.key], sec)
@@ -0,0 +1,215 @@
+package configstore
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"sync"
+	"time"
+)
+
+// loader keeps an in-memory provider in sync with the source its items are loaded from (file, directory, ...).
+// Watchers are only notified when the loaded items actually differ from the previous ones.
+type loader struct {
+	s     *Store
+	inmem *InMemoryProvider
+	load  func() ([]Item, error)
+	opts  providerOptions
+	state *providerTracker
+
+	mut    sync.Mutex
+	hash   [sha256.Size]byte
+	timer  *time.Timer
+	loaded bool
+	err    error
+}
+
+func newLoader(s *Store, inmem *InMemoryProvider, load func() ([]Item, error), opts providerOptions) *loader {
+	if opts.optional {
+		mandatoryLoad := load
+		load = func() ([]Item, error) {
+			items, err := mandatoryLoad()
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil, nil
+			}
+			return items, err
+		}
+	}
+	return &loader{s: s, inmem: inmem, load: load, opts: opts, state: &providerTracker{}}
+}
+
+// register registers the loaded items as a reloadable provider of the store.
+func (l *loader) register(name string) {
+	l.s.registerProvider(name, l.opts.entry(l.s, &providerEntry{provider: l.Items, reload: l.Reload, state: l.state, selfReported: true}))
+}
+
+// watch keeps the items up to date with the changes of path, according to the refresh mode.
+// When notifications cannot be set up with the notify function, polling is used instead.
+func (l *loader) watch(name, path string, opts providerOptions, notify func(*Store, string, func()) error) {
+	switch opts.refresh {
+	case refreshNone:
+		return
+	case refreshNotify:
+		if _, err := os.Stat(path); opts.optional && errors.Is(err, fs.ErrNotExist) {
+			// nothing to watch yet, wait for the source to appear
+			pollPath(l.s, path, opts.pollInterval, l.trigger)
+			break
+		}
+		err := notify(l.s, path, l.trigger)
+		if err == nil {
+			break
+		}
+		logError(fmt.Errorf("%s: cannot watch %s, falling back to polling: %w", name, path, err))
+		pollPath(l.s, path, opts.pollInterval, l.trigger)
+	case refreshPoll:
+		pollPath(l.s, path, opts.pollInterval, l.trigger)
+	}
+	l.state.setWatching(true)
+}
+
+// poll reloads the items at the given interval, until the store is closed.
+func (l *loader) poll(interval time.Duration) {
+	if interval <= 0 {
+		interval = DefaultPollInterval
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-l.s.ctx.Done():
+				return
+			case <-ticker.C:
+				l.trigger()
+			}
+		}
+	}()
+	l.state.setWatching(true)
+}
+
+// fail records a load failure. Until items are successfully loaded, the provider returns that error.
+func (l *loader) fail(err error) {
+	l.state.record(0, err)
+	l.mut.Lock()
+	defer l.mut.Unlock()
+	l.err = err
+}
+
+// set replaces the provider items, and reports whether they changed.
+func (l *loader) set(items []Item) bool {
+	l.state.record(len(items), nil)
+	h := hashItems(items)
+
+	l.mut.Lock()
+	defer l.mut.Unlock()
+	wasLoaded := l.loaded
+	l.loaded, l.err = true, nil
+	if h == l.hash && wasLoaded {
+		return false
+	}
+	l.hash = h
+
+	l.inmem.mut.Lock()
+	l.inmem.items = items
+	l.inmem.mut.Unlock()
+	return true
+}
+
+// reload loads the items from the source, and notifies the watchers if they changed.
+func (l *loader) reload() {
+	items, err := l.load()
+	if err != nil {
+		l.fail(err)
+		logError(err)
+		return
+	}
+	if l.set(items) {
+		l.s.NotifyWatchers()
+	}
+}
+
+// Reload loads the items from the source, without notifying the watchers. It implements Reloadable.
+func (l *loader) Reload(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	items, err := l.load()
+	if err != nil {
+		l.fail(err)
+		return err
+	}
+	l.set(items)
+	return nil
+}
+
+// Items returns the loaded items. It implements Reloadable.
+// If items were never successfully loaded, the load error is returned.
+func (l *loader) Items() (ItemList, error) {
+	l.mut.Lock()
+	loaded, err := l.loaded, l.err
+	l.mut.Unlock()
+	if !loaded && err != nil {
+		return ItemList{}, err
+	}
+	return l.inmem.Items()
+}
+
+// trigger schedules a reload. Triggers received within the debounce delay are coalesced into a single reload.
+func (l *loader) trigger() {
+	debounce := l.opts.debounce
+	if debounce == 0 {
+		debounce = l.s.getRefreshDebounce()
+	}
+	if debounce <= 0 {
+		l.reload()
+		return
+	}
+
+	l.mut.Lock()
+	defer l.mut.Unlock()
+	if l.timer != nil {
+		l.timer.Reset(debounce)
+		return
+	}
+	l.timer = time.AfterFunc(debounce, func() {
+		l.mut.Lock()
+		l.timer = nil
+		l.mut.Unlock()
+		select {
+		case <-l.s.ctx.Done():
+			return
+		default:
+		}
+		l.reload()
+	})
+}
+
+// hashItems computes a digest of an item list, suitable to detect content changes.
+func hashItems(items []Item) [sha256.Size]byte {
+	h := sha256.New()
+	var buf [binary.MaxVarintLen64]byte
+	writeString := func(str string) {
+		n := binary.PutUvarint(buf[:], uint64(len(str)))
+		h.Write(buf[:n])
+		h.Write([]byte(str))
+	}
+	for _, it := range items {
+		writeString(it.key)
+		writeString(it.value)
+		writeString(it.description)
+		n := binary.PutVarint(buf[:], it.priority)
+		h.Write(buf[:n])
+		if it.sensitive {
+			h.Write([]byte{1})
+		} else {
+			h.Write([]byte{0})
+		}
+	}
+	var sum [sha256.Size]byte
+	copy(sum[:], h.Sum(nil))
+	return sum
+}
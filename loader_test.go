@@ -0,0 +1,66 @@
+package configstore
+
+import (
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ovh/configstore/internal/storetest"
+)
+
+func TestLoaderSuppressesIdenticalReloads(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "test.yaml")
+	require.NoError(t, os.WriteFile(filename, []byte("- key: foo\n  value: bar\n"), 0o600))
+
+	s := NewStore()
+	defer s.Close()
+	s.FilePoll(filename, 10*time.Millisecond)
+	ch := s.Watch()
+
+	// same content, different mtime: the file is reloaded, but watchers must not be notified
+	later := time.Now().Add(time.Hour)
+	require.NoError(t, os.Chtimes(filename, later, later))
+	select {
+	case <-ch:
+		require.FailNow(t, "watchers notified without any item change")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	require.NoError(t, os.WriteFile(filename, []byte("- key: foo\n  value: baz\n"), 0o600))
+	storetest.WaitNotification(t, ch)
+}
+
+func TestLoaderDebounce(t *testing.T) {
+	s := NewStore()
+	defer s.Close()
+	s.SetRefreshDebounce(50 * time.Millisecond)
+	ch := s.Watch()
+
+	var loads int32
+	inmem := inMemoryProvider(s, "test", providerOptions{})
+	<-ch
+	l := newLoader(s, inmem, func() ([]Item, error) {
+		n := atomic.AddInt32(&loads, 1)
+		return []Item{NewItem("foo", "bar", int64(n))}, nil
+	}, providerOptions{})
+
+	for i := 0; i < 10; i++ {
+		l.trigger()
+	}
+	storetest.WaitNotification(t, ch)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&loads))
+}
+
+func TestHashItems(t *testing.T) {
+	a := []Item{NewItem("foo", "bar", 1)}
+	b := []Item{NewItem("foo", "bar", 2)}
+	c := []Item{NewItem("foob", "ar", 1)}
+	assert.Equal(t, hashItems(a), hashItems([]Item{NewItem("foo", "bar", 1)}))
+	assert.NotEqual(t, hashItems(a), hashItems(b))
+	assert.NotEqual(t, hashItems(a), hashItems(c))
+}
@@ -0,0 +1,317 @@
+// Package openstack provides a configstore provider reading the instance metadata of an OpenStack instance,
+// from the metadata service or from a config drive.
+//
+// The fields of meta_data.json and vendor_data.json are mapped to items prefixed with "openstack/", nested objects
+// being flattened with slashes (e.g. "openstack/meta/role" for the "role" instance property), and the user data
+// is exposed as "openstack/user-data". The EC2-compatible metadata can be read as well, as items prefixed with "ec2/"
+// (e.g. "ec2/instance-id", "ec2/placement/availability-zone").
+// The items get a low priority (Config.Priority, 0 by default), so that any other source takes precedence.
+//
+// Importing the package registers the "openstack" provider factory, whose argument is either empty (metadata service),
+// the URL of the metadata service, or the directory where the config drive is mounted:
+//
+//	CONFIGURATION_FROM=openstack:?ec2=true
+//	CONFIGURATION_FROM=openstack:/mnt/config?optional=true
+package openstack
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ovh/configstore"
+)
+
+func init() {
+	configstore.RegisterProviderFactoryInfo(configstore.ProviderFactoryInfo{
+		Name:        "openstack",
+		Description: "Reads the OpenStack instance metadata, from the metadata service or from a config drive.",
+		Syntax:      "openstack:[<metadata service URL>|<config drive directory>]",
+		Examples:    []string{"openstack:?ec2=true", "openstack:/mnt/config"},
+		Options:     []string{"ec2", "timeout", "optional"},
+		Factory:     factory,
+	})
+}
+
+const (
+	// DefaultEndpoint is the address of the metadata service.
+	DefaultEndpoint = "http://169.254.169.254"
+	// DefaultTimeout is the timeout of the requests to the metadata service.
+	DefaultTimeout = 5 * time.Second
+)
+
+// Config configures the openstack provider, see Register and RegisterConfigDrive.
+type Config struct {
+	// Endpoint is the address of the metadata service (DefaultEndpoint by default).
+	Endpoint string
+	// HTTPClient is the client used for the requests. By default, its timeout is DefaultTimeout.
+	HTTPClient *http.Client
+	// EC2 also reads the EC2-compatible metadata.
+	EC2 bool
+	// Priority is the priority of the items.
+	Priority int64
+}
+
+func factory(s *configstore.Store, spec configstore.ProviderSpec) error {
+	var cfg Config
+	opts := spec.ProviderOptions()
+	var optional bool
+	var err error
+	cfg.EC2, err = spec.BoolOption("ec2", false)
+	if err == nil {
+		optional, err = spec.BoolOption("optional", false)
+	}
+	if optional {
+		opts = append(opts, configstore.Optional())
+	}
+	if err == nil {
+		var timeout time.Duration
+		timeout, err = spec.DurationOption("timeout", DefaultTimeout)
+		cfg.HTTPClient = &http.Client{Timeout: timeout}
+	}
+	if err != nil {
+		s.ErrorProvider("openstack:"+spec.Arg, err)
+		return err
+	}
+	if spec.Arg != "" && !strings.Contains(spec.Arg, "://") {
+		return RegisterConfigDrive(s, spec.Arg, cfg, opts...)
+	}
+	cfg.Endpoint = spec.Arg
+	return Register(s, cfg, opts...)
+}
+
+// Register registers a provider reading the metadata service, named "openstack:<endpoint>".
+// The metadata is read once. On failure, a failing provider is registered. With configstore.Optional(), the provider
+// is empty if the metadata service cannot be reached, e.g. off OpenStack.
+func Register(s *configstore.Store, cfg Config, opts ...configstore.ProviderOption) error {
+	if cfg.Endpoint == "" {
+		cfg.Endpoint = DefaultEndpoint
+	}
+	cfg.Endpoint = strings.TrimSuffix(cfg.Endpoint, "/")
+	if cfg.HTTPClient == nil {
+		cfg.HTTPClient = &http.Client{Timeout: DefaultTimeout}
+	}
+	src := &metadataService{cfg: cfg}
+	return register(s, "openstack:"+cfg.Endpoint, src, cfg, opts)
+}
+
+// RegisterConfigDrive registers a provider reading the config drive mounted at dir, named "openstack:<dir>".
+// The metadata is read once. On failure, a failing provider is registered. With configstore.Optional(), the provider
+// is empty if the config drive is not mounted.
+func RegisterConfigDrive(s *configstore.Store, dir string, cfg Config, opts ...configstore.ProviderOption) error {
+	return register(s, "openstack:"+dir, configDrive(dir), cfg, opts)
+}
+
+// source reads the metadata documents, either from the metadata service or from a config drive.
+// A missing document is reported with an error wrapping fs.ErrNotExist.
+type source interface {
+	// read returns a document of the OpenStack metadata, e.g. "meta_data.json".
+	read(name string) ([]byte, error)
+	// ec2 returns the EC2-compatible metadata, as a tree of JSON values.
+	ec2() (map[string]any, error)
+}
+
+func register(s *configstore.Store, name string, src source, cfg Config, opts []configstore.ProviderOption) error {
+	r := s.NewRemote(name)
+	items, err := load(src, cfg)
+	if err == nil {
+		r.Set(items...)
+	}
+	var unreachable unreachableError
+	if errors.As(err, &unreachable) {
+		// off OpenStack, an optional provider is empty
+		err = absentError{unreachable}
+	}
+	return r.Register(err, false, opts...)
+}
+
+// load reads the metadata, and maps it to items.
+func load(src source, cfg Config) ([]configstore.Item, error) {
+	var items []configstore.Item
+	add := func(key, value string) {
+		items = append(items, configstore.NewItem(key, value, cfg.Priority))
+	}
+
+	for _, doc := range []struct {
+		name, prefix string
+		optional     bool
+	}{
+		{"meta_data.json", "openstack", false},
+		{"vendor_data.json", "openstack/vendor-data", true},
+	} {
+		b, err := src.read(doc.name)
+		if doc.optional && errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		var v map[string]any
+		if err := json.Unmarshal(b, &v); err != nil {
+			return nil, fmt.Errorf("openstack: %s: %w", doc.name, err)
+		}
+		flatten(doc.prefix, v, add)
+	}
+
+	b, err := src.read("user_data")
+	switch {
+	case err == nil:
+		add("openstack/user-data", string(b))
+	case !errors.Is(err, fs.ErrNotExist):
+		return nil, err
+	}
+
+	if cfg.EC2 {
+		tree, err := src.ec2()
+		if err != nil {
+			return nil, err
+		}
+		flatten("ec2", tree, add)
+	}
+	return items, nil
+}
+
+// flatten calls add for each leaf of a JSON value, named after its path. Arrays are kept as JSON documents.
+func flatten(key string, v any, add func(key, value string)) {
+	switch v := v.(type) {
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			flatten(key+"/"+k, v[k], add)
+		}
+	case string:
+		add(key, v)
+	case nil:
+		add(key, "")
+	default:
+		b, _ := json.Marshal(v)
+		add(key, string(b))
+	}
+}
+
+// configDrive reads the metadata from a mounted config drive.
+type configDrive string
+
+func (d configDrive) read(name string) ([]byte, error) {
+	return os.ReadFile(filepath.Join(string(d), "openstack", "latest", name))
+}
+
+func (d configDrive) ec2() (map[string]any, error) {
+	b, err := os.ReadFile(filepath.Join(string(d), "ec2", "latest", "meta-data.json"))
+	if err != nil {
+		return nil, err
+	}
+	var tree map[string]any
+	if err := json.Unmarshal(b, &tree); err != nil {
+		return nil, fmt.Errorf("openstack: %s: %w", d, err)
+	}
+	return tree, nil
+}
+
+// metadataService reads the metadata from the metadata service.
+type metadataService struct {
+	cfg Config
+}
+
+func (m *metadataService) read(name string) ([]byte, error) {
+	return m.get("/openstack/latest/" + name)
+}
+
+// ec2 browses the EC2-compatible metadata tree, where directories are listed one entry per line,
+// with a trailing slash for sub-directories.
+func (m *metadataService) ec2() (map[string]any, error) {
+	return m.ec2Dir("/latest/meta-data/", 0)
+}
+
+func (m *metadataService) ec2Dir(path string, depth int) (map[string]any, error) {
+	if depth > 8 {
+		return nil, fmt.Errorf("openstack: %s: too deep", path)
+	}
+	b, err := m.get(path)
+	if err != nil {
+		return nil, err
+	}
+	tree := map[string]any{}
+	scanner := bufio.NewScanner(strings.NewReader(string(b)))
+	for scanner.Scan() {
+		entry := strings.TrimSpace(scanner.Text())
+		if entry == "" {
+			continue
+		}
+		// public keys are listed as "<index>=<name>", and are directories
+		if i := strings.IndexByte(entry, '='); i > 0 {
+			entry = entry[:i] + "/"
+		}
+		name := strings.TrimSuffix(entry, "/")
+		if name != entry {
+			sub, err := m.ec2Dir(path+entry, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			tree[name] = sub
+			continue
+		}
+		v, err := m.get(path + entry)
+		if err != nil {
+			return nil, err
+		}
+		tree[name] = string(v)
+	}
+	return tree, nil
+}
+
+// unreachableError is returned when the metadata service cannot be reached, e.g. off OpenStack, or on a transient
+// failure. Unlike a missing document, it fails the load.
+type unreachableError struct {
+	err error
+}
+
+func (e unreachableError) Error() string {
+	return "openstack: metadata service unreachable: " + e.err.Error()
+}
+
+func (e unreachableError) Unwrap() error {
+	return e.err
+}
+
+// absentError wraps fs.ErrNotExist around an unreachable metadata service, so that an optional provider is empty.
+type absentError struct {
+	unreachableError
+}
+
+func (e absentError) Unwrap() []error {
+	return []error{fs.ErrNotExist, e.err}
+}
+
+func (m *metadataService) get(path string) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodGet, m.cfg.Endpoint+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := m.cfg.HTTPClient.Do(req)
+	if err != nil {
+		return nil, unreachableError{err}
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return io.ReadAll(resp.Body)
+	case http.StatusNotFound:
+		return nil, fmt.Errorf("openstack: %s: %w", path, fs.ErrNotExist)
+	default:
+		return nil, fmt.Errorf("openstack: %s: unexpected status: %s", path, resp.Status)
+	}
+}
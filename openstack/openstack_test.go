@@ -0,0 +1,165 @@
+package openstack
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ovh/configstore"
+)
+
+const fixtures = "../tests/fixtures/configdrive"
+
+// ec2Metadata mimics the EC2-compatible metadata tree of the metadata service.
+var ec2Metadata = map[string]string{
+	"/latest/meta-data/":                            "instance-id\ninstance-type\nlocal-ipv4\nplacement/\npublic-keys/\n",
+	"/latest/meta-data/instance-id":                 "i-00000042",
+	"/latest/meta-data/instance-type":               "b2-7",
+	"/latest/meta-data/local-ipv4":                  "10.0.0.42",
+	"/latest/meta-data/placement/":                  "availability-zone",
+	"/latest/meta-data/placement/availability-zone": "nova",
+	"/latest/meta-data/public-keys/":                "0=mykey",
+	"/latest/meta-data/public-keys/0/":              "openssh-key",
+	"/latest/meta-data/public-keys/0/openssh-key":   "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIHt1 user@host",
+}
+
+// fakeMetadataService serves the config drive fixtures as the OpenStack metadata, and the EC2-compatible tree.
+func fakeMetadataService() http.Handler {
+	files := http.FileServer(http.Dir(fixtures))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/latest/") {
+			v, ok := ec2Metadata[r.URL.Path]
+			if !ok {
+				http.NotFound(w, r)
+				return
+			}
+			_, _ = w.Write([]byte(v))
+			return
+		}
+		files.ServeHTTP(w, r)
+	})
+}
+
+func assertValues(t *testing.T, s *configstore.Store, expected map[string]string) {
+	t.Helper()
+	items, err := s.GetItemList()
+	require.NoError(t, err)
+	for key, value := range expected {
+		i, err := items.GetItem(key)
+		if assert.NoError(t, err, key) {
+			v, _ := i.Value()
+			assert.Equal(t, value, v, key)
+		}
+	}
+}
+
+var openstackValues = map[string]string{
+	"openstack/uuid":                     "d8e02d56-2648-49a3-bf97-6be8f1204f38",
+	"openstack/hostname":                 "web-1.novalocal",
+	"openstack/availability-zone":        "nova",
+	"openstack/launch-index":             "0",
+	"openstack/meta/role":                "webserver",
+	"openstack/devices":                  "[]",
+	"openstack/vendor-data/cloud/region": "GRA",
+	"openstack/user-data":                "#cloud-config\nhostname: web-1\n",
+}
+
+func TestMetadataService(t *testing.T) {
+	ts := httptest.NewServer(fakeMetadataService())
+	defer ts.Close()
+
+	s := configstore.NewStore()
+	defer s.Close()
+	require.NoError(t, Register(s, Config{Endpoint: ts.URL, EC2: true}))
+	assertValues(t, s, openstackValues)
+	assertValues(t, s, map[string]string{
+		"ec2/instance-id":                 "i-00000042",
+		"ec2/placement/availability-zone": "nova",
+		"ec2/public-keys/0/openssh-key":   "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIHt1 user@host",
+	})
+
+	i, err := s.GetItem("openstack/name")
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), i.Priority())
+	assert.Equal(t, "openstack:"+ts.URL, i.Provider())
+
+	// a missing meta_data.json registers a failing provider
+	s = configstore.NewStore()
+	defer s.Close()
+	assert.Error(t, Register(s, Config{Endpoint: ts.URL + "/nowhere"}))
+	_, err = s.GetItemList()
+	assert.Error(t, err)
+
+	// off OpenStack, the metadata service cannot be reached
+	ts.Close()
+	s = configstore.NewStore()
+	defer s.Close()
+	assert.Error(t, Register(s, Config{Endpoint: ts.URL}))
+	t.Setenv(configstore.ConfigEnvVar, "openstack:"+ts.URL+"?optional=true")
+	s = configstore.NewStore()
+	defer s.Close()
+	require.NoError(t, s.InitFromEnvironment())
+	items, err := s.GetItemList()
+	require.NoError(t, err)
+	assert.Equal(t, 0, items.Len())
+}
+
+func TestConfigDrive(t *testing.T) {
+	s := configstore.NewStore()
+	defer s.Close()
+	require.NoError(t, RegisterConfigDrive(s, fixtures, Config{EC2: true, Priority: 2}))
+	assertValues(t, s, openstackValues)
+	assertValues(t, s, map[string]string{
+		"ec2/instance-id":                 "i-00000042",
+		"ec2/placement/availability-zone": "nova",
+	})
+	i, err := s.GetItem("ec2/local-ipv4")
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), i.Priority())
+
+	// a config drive which is not mounted
+	s = configstore.NewStore()
+	defer s.Close()
+	assert.Error(t, RegisterConfigDrive(s, "/does/not/exist", Config{}))
+	_, err = s.GetItemList()
+	assert.Error(t, err)
+
+	s = configstore.NewStore()
+	defer s.Close()
+	require.NoError(t, RegisterConfigDrive(s, "/does/not/exist", Config{}, configstore.Optional()))
+	items, err := s.GetItemList()
+	require.NoError(t, err)
+	assert.Equal(t, 0, items.Len())
+}
+
+// flakySource serves the config drive fixtures, but fails to read one of the documents.
+type flakySource struct {
+	configDrive
+	failing string
+}
+
+func (f flakySource) read(name string) ([]byte, error) {
+	if name == f.failing {
+		return nil, unreachableError{errors.New("i/o timeout")}
+	}
+	return f.configDrive.read(name)
+}
+
+func TestTransientFailure(t *testing.T) {
+	// a document which cannot be read is not taken as absent
+	for _, doc := range []string{"vendor_data.json", "user_data"} {
+		_, err := load(flakySource{configDrive(fixtures), doc}, Config{})
+		assert.ErrorContains(t, err, "i/o timeout", doc)
+
+		s := configstore.NewStore()
+		defer s.Close()
+		assert.Error(t, register(s, "openstack:flaky", flakySource{configDrive(fixtures), doc}, Config{}, nil), doc)
+		_, err = s.GetItemList()
+		assert.Error(t, err, doc)
+	}
+}
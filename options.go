@@ -0,0 +1,99 @@
+package configstore
+
+import (
+	"time"
+)
+
+// refreshMode describes how a file based provider keeps its items up to date.
+type refreshMode int
+
+const (
+	refreshNone   refreshMode = iota // static content, read once
+	refreshNotify                    // filesystem notifications (inotify & co), polling if unavailable
+	refreshPoll                      // periodic polling of the files stat and content
+)
+
+// providerOptions holds the settings shared by the built-in provider implementations.
+type providerOptions struct {
+	refresh      refreshMode
+	pollInterval time.Duration
+	debounce     time.Duration
+	optional     bool
+	priority     priorityRule
+	rank         *int
+	cache        time.Duration
+	retry        *RetryPolicy
+}
+
+// A ProviderOption customizes a provider when it is registered, e.g. Store.File(filename, Optional()).
+type ProviderOption func(*providerOptions)
+
+// Optional makes a file based provider (File, FileList, FileTree and their variants) tolerate a missing file or directory,
+// which is then treated as empty. Refreshing providers start loading it automatically once it appears.
+// The HTTP providers and the providers registered with Remote.Register treat the errors wrapping fs.ErrNotExist the same way.
+func Optional() ProviderOption {
+	return func(o *providerOptions) {
+		o.optional = true
+	}
+}
+
+// Rank sets the merge rank of the provider (0 by default). Providers are merged by ascending rank, then in
+// registration order, which defines the order of the items sharing the same priority.
+func Rank(rank int) ProviderOption {
+	return func(o *providerOptions) {
+		o.rank = &rank
+	}
+}
+
+// apply returns a copy of the options, customized by opts.
+func (o providerOptions) apply(opts []ProviderOption) providerOptions {
+	for _, opt := range opts {
+		if opt != nil {
+			opt(&o)
+		}
+	}
+	return o
+}
+
+// hasEntrySettings reports whether the options hold store-level settings, see entry.
+func (o providerOptions) hasEntrySettings() bool {
+	return !o.priority.isZero() || o.rank != nil || o.cache > 0 || o.retry != nil
+}
+
+// entry applies the store-level settings to a provider entry.
+func (o providerOptions) entry(s *Store, e *providerEntry) *providerEntry {
+	if !o.priority.isZero() {
+		e.priority = o.priority
+	}
+	if o.rank != nil {
+		e.rank = *o.rank
+	}
+	if o.retry != nil {
+		e.provider = newResilientProvider(s, e.provider, *o.retry).Items
+	}
+	if o.cache > 0 {
+		c := newCachedProvider(s, e.provider, e.reload, o.cache)
+		e.provider = c.Items
+		e.reload = c.Reload
+	}
+	return e
+}
+
+// specProviderOptions reads the options of a file based provider spec.
+func specProviderOptions(spec ProviderSpec, refresh refreshMode) (providerOptions, error) {
+	opts := providerOptions{refresh: refresh}.apply(spec.ProviderOptions())
+	var err error
+	opts.pollInterval, err = spec.DurationOption("interval", 0)
+	if err != nil {
+		return opts, err
+	}
+	opts.debounce, err = spec.DurationOption("debounce", 0)
+	if err != nil {
+		return opts, err
+	}
+	opts.optional, err = spec.BoolOption("optional", false)
+	if err != nil {
+		return opts, err
+	}
+	return opts, nil
+}
@@ -0,0 +1,116 @@
+package configstore
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ovh/configstore/internal/storetest"
+)
+
+func TestOptionalProviders(t *testing.T) {
+	dirname := t.TempDir()
+
+	s := NewStore()
+	defer s.Close()
+	s.File(filepath.Join(dirname, "missing.yaml"), Optional())
+	s.FileList(filepath.Join(dirname, "missing-list"), Optional())
+	s.FileTree(filepath.Join(dirname, "missing-tree"), Optional())
+
+	l, err := s.GetItemList()
+	require.NoError(t, err)
+	assert.Equal(t, 0, l.Len())
+
+	s.File(filepath.Join(dirname, "other-missing.yaml"))
+	_, err = s.GetItemList()
+	assert.Error(t, err)
+}
+
+func TestOptionalRefreshProvider(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "test.yaml")
+
+	s := NewStore()
+	defer s.Close()
+	s.FilePoll(filename, 10*time.Millisecond, Optional())
+	ch := s.Watch()
+
+	_, err := s.GetItemValue("foo")
+	require.Error(t, err)
+
+	require.NoError(t, os.WriteFile(filename, []byte("- key: foo\n  value: bar\n"), 0o600))
+	storetest.WaitNotification(t, ch)
+
+	v, err := s.GetItemValue("foo")
+	require.NoError(t, err)
+	assert.Equal(t, "bar", v)
+
+	// the file disappearing is not an error either
+	require.NoError(t, os.Remove(filename))
+	storetest.WaitNotification(t, ch)
+	_, err = s.GetItemList()
+	require.NoError(t, err)
+	assert.NoError(t, s.ProviderStatus()["file+poll:"+filename].LastError)
+}
+
+func TestOptionalTreeRefreshProvider(t *testing.T) {
+	dirname := filepath.Join(t.TempDir(), "tree")
+
+	s := NewStore()
+	defer s.Close()
+	s.FileTreeRefresh(dirname, Optional(), func(o *providerOptions) { o.pollInterval = 10 * time.Millisecond })
+	ch := s.Watch()
+
+	require.NoError(t, os.Mkdir(dirname, 0o700))
+	require.NoError(t, os.WriteFile(filepath.Join(dirname, "foo"), []byte("bar"), 0o600))
+	storetest.WaitNotification(t, ch)
+
+	require.Eventually(t, func() bool {
+		v, err := s.GetItemValue("foo")
+		return err == nil && v == "bar"
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestOptionalFileListRefreshProvider(t *testing.T) {
+	dirname := filepath.Join(t.TempDir(), "list")
+
+	s := NewStore()
+	defer s.Close()
+	s.FileListPoll(dirname, 10*time.Millisecond, Optional())
+	ch := s.Watch()
+
+	require.NoError(t, os.Mkdir(dirname, 0o700))
+	require.NoError(t, os.WriteFile(filepath.Join(dirname, "a.yaml"), []byte("- key: foo\n  value: bar\n"), 0o600))
+	storetest.WaitNotification(t, ch)
+
+	require.Eventually(t, func() bool {
+		v, err := s.GetItemValue("foo")
+		return err == nil && v == "bar"
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// the files added later on are picked up as well, with notifications
+	s2 := NewStore()
+	defer s2.Close()
+	s2.FileListRefresh(dirname, Optional())
+	ch2 := s2.Watch()
+	tmp := filepath.Join(t.TempDir(), "b.yaml")
+	require.NoError(t, os.WriteFile(tmp, []byte("- key: baz\n  value: qux\n"), 0o600))
+	require.NoError(t, os.Rename(tmp, filepath.Join(dirname, "b.yaml")))
+	storetest.WaitNotification(t, ch2)
+	require.Eventually(t, func() bool {
+		v, err := s2.GetItemValue("baz")
+		return err == nil && v == "qux"
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestOptionalFromEnvironment(t *testing.T) {
+	t.Setenv(ConfigEnvVar, "file:/does/not/exist.yaml?optional=true,filetree+refresh:/does/not/exist?optional=1")
+	s := NewStore()
+	defer s.Close()
+	require.NoError(t, s.InitFromEnvironment())
+	_, err := s.GetItemList()
+	require.NoError(t, err)
+}
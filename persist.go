@@ -0,0 +1,212 @@
+package configstore
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// persistentCache saves the last successfully merged item list to a local file, so that it can be served
+// at startup if the providers fail.
+type persistentCache struct {
+	path string
+	// aead encrypts the sensitive values. When nil, sensitive items are not saved.
+	aead cipher.AEAD
+
+	mut  sync.Mutex
+	hash [sha256.Size]byte
+	// synced is set once the providers have been successfully merged by this process.
+	synced bool
+	// read is set once the cache file has been read, and saved holds its items by provider.
+	read  bool
+	saved map[string][]Item
+}
+
+type persistedList struct {
+	Saved time.Time       `json:"saved"`
+	Items []persistedItem `json:"items"`
+}
+
+type persistedItem struct {
+	Key         string `json:"key"`
+	Value       string `json:"value,omitempty"`
+	Encrypted   []byte `json:"encrypted,omitempty"`
+	Priority    int64  `json:"priority"`
+	Sensitive   bool   `json:"sensitive,omitempty"`
+	Description string `json:"description,omitempty"`
+	Provider    string `json:"provider,omitempty"`
+	Origin      int    `json:"origin"`
+}
+
+// SetPersistentCache enables the on-disk cache of the last good configuration: every time the providers are successfully
+// merged, the item list is saved to path. If some providers fail before the first successful merge (e.g. a remote
+// source is unreachable at startup), GetItemList serves their saved items instead, flagged as stale (see Item.Stale),
+// along with the items of the other providers.
+//
+// Sensitive items are only saved if key is set: their values are then encrypted with AES-GCM (key must be 16, 24 or 32 bytes long).
+// An empty path disables the cache.
+func (s *Store) SetPersistentCache(path string, key []byte) error {
+	var p *persistentCache
+	if path != "" {
+		p = &persistentCache{path: path}
+		if len(key) > 0 {
+			block, err := aes.NewCipher(key)
+			if err != nil {
+				return fmt.Errorf("configstore: persistent cache: %w", err)
+			}
+			p.aead, err = cipher.NewGCM(block)
+			if err != nil {
+				return fmt.Errorf("configstore: persistent cache: %w", err)
+			}
+		}
+	}
+	s.pMut.Lock()
+	defer s.pMut.Unlock()
+	s.persistent = p
+	return nil
+}
+
+// save writes the merged items to the cache file, if they changed.
+func (p *persistentCache) save(items []Item) {
+	p.mut.Lock()
+	defer p.mut.Unlock()
+	p.synced = true
+
+	h := hashItems(items)
+	if h == p.hash {
+		return
+	}
+	if err := p.write(items); err != nil {
+		logError(fmt.Errorf("configstore: persistent cache: %w", err))
+		return
+	}
+	p.hash = h
+}
+
+func (p *persistentCache) write(items []Item) error {
+	l := persistedList{Saved: time.Now().UTC(), Items: make([]persistedItem, 0, len(items))}
+	for _, it := range items {
+		pi := persistedItem{
+			Key:         it.key,
+			Priority:    it.priority,
+			Sensitive:   it.sensitive,
+			Description: it.description,
+			Provider:    it.provider,
+			Origin:      it.origin,
+		}
+		switch {
+		case !it.sensitive:
+			pi.Value = it.value
+		case p.aead == nil:
+			continue
+		default:
+			nonce := make([]byte, p.aead.NonceSize())
+			if _, err := rand.Read(nonce); err != nil {
+				return err
+			}
+			pi.Encrypted = p.aead.Seal(nonce, nonce, []byte(it.value), []byte(it.key))
+		}
+		l.Items = append(l.Items, pi)
+	}
+	b, err := json.Marshal(l)
+	if err != nil {
+		return err
+	}
+
+	// write then rename, so that the cache file is never partially written
+	tmp, err := os.CreateTemp(filepath.Dir(p.path), filepath.Base(p.path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), p.path)
+}
+
+// load returns the saved items by provider, flagged as stale, or nil if the providers have already been successfully
+// merged by this process, or if nothing was saved. The cache file is only read once.
+func (p *persistentCache) load() map[string][]Item {
+	p.mut.Lock()
+	defer p.mut.Unlock()
+	if p.synced {
+		return nil
+	}
+	if !p.read {
+		p.read = true
+		p.saved = p.readFile()
+	}
+	return p.saved
+}
+
+// readFile reads and decrypts the cache file.
+func (p *persistentCache) readFile() map[string][]Item {
+	b, err := os.ReadFile(p.path)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			logError(fmt.Errorf("configstore: persistent cache: %w", err))
+		}
+		return nil
+	}
+	var l persistedList
+	if err := json.Unmarshal(b, &l); err != nil {
+		logError(fmt.Errorf("configstore: persistent cache: %s: %w", p.path, err))
+		return nil
+	}
+
+	saved := make(map[string][]Item)
+	for _, pi := range l.Items {
+		it := Item{
+			key:         pi.Key,
+			value:       pi.Value,
+			priority:    pi.Priority,
+			sensitive:   pi.Sensitive,
+			description: pi.Description,
+			provider:    pi.Provider,
+			origin:      pi.Origin,
+			stale:       true,
+		}
+		if pi.Encrypted != nil {
+			value, err := p.decrypt(pi)
+			if err != nil {
+				logError(fmt.Errorf("configstore: persistent cache: cannot decrypt '%s': %w", pi.Key, err))
+				continue
+			}
+			it.value = value
+		}
+		saved[pi.Provider] = append(saved[pi.Provider], it)
+	}
+	if LogInfoFunc != nil {
+		LogInfoFunc("configuration from persistent cache: %s (saved at %s)", p.path, l.Saved.Format(time.RFC3339))
+	}
+	return saved
+}
+
+func (p *persistentCache) decrypt(pi persistedItem) (string, error) {
+	if p.aead == nil {
+		return "", errors.New("no encryption key")
+	}
+	n := p.aead.NonceSize()
+	if len(pi.Encrypted) < n {
+		return "", errors.New("invalid encrypted value")
+	}
+	b, err := p.aead.Open(nil, pi.Encrypted[:n], pi.Encrypted[n:], []byte(pi.Key))
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
@@ -0,0 +1,141 @@
+package configstore
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func persistTestItems() []Item {
+	secret := NewItem("password", "s3cr3t", 0)
+	secret.sensitive = true
+	return []Item{NewItem("foo", "bar", 5), secret}
+}
+
+func TestPersistentCache(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.json")
+
+	s := NewStore()
+	defer s.Close()
+	require.NoError(t, s.SetPersistentCache(path, nil))
+	s.InMemory("remote").Add(persistTestItems()...)
+	_, err := s.GetItemList()
+	require.NoError(t, err)
+
+	b, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Contains(t, string(b), `"provider":"remote"`)
+	assert.NotContains(t, string(b), "password")
+
+	// the providers fail at startup: the saved items are served
+	errDown := errors.New("source is down")
+	var down atomic.Bool
+	down.Store(true)
+	s2 := NewStore()
+	defer s2.Close()
+	require.NoError(t, s2.SetPersistentCache(path, nil))
+	s2.RegisterProvider("remote", func() (ItemList, error) {
+		if down.Load() {
+			return ItemList{}, errDown
+		}
+		return ItemList{Items: []Item{NewItem("foo", "fresh", 5)}}, nil
+	})
+
+	i, err := s2.GetItem("foo")
+	require.NoError(t, err)
+	assert.Equal(t, "bar", i.value)
+	assert.Equal(t, int64(5), i.Priority())
+	assert.Equal(t, "remote", i.Provider())
+	assert.True(t, i.Stale())
+	_, err = s2.GetItem("password")
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.ErrorIs(t, s2.ProviderStatus()["remote"].LastError, errDown)
+
+	// once the providers have been merged, failures are reported again
+	down.Store(false)
+	i, err = s2.GetItem("foo")
+	require.NoError(t, err)
+	assert.Equal(t, "fresh", i.value)
+	assert.False(t, i.Stale())
+	down.Store(true)
+	_, err = s2.GetItemList()
+	assert.ErrorIs(t, err, errDown)
+}
+
+func TestPersistentCacheEncryption(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.json")
+	key := []byte("0123456789abcdef0123456789abcdef")
+
+	s := NewStore()
+	defer s.Close()
+	require.NoError(t, s.SetPersistentCache(path, key))
+	s.InMemory("remote").Add(persistTestItems()...)
+	_, err := s.GetItemList()
+	require.NoError(t, err)
+
+	b, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Contains(t, string(b), "password")
+	assert.NotContains(t, string(b), "s3cr3t")
+
+	s2 := NewStore()
+	defer s2.Close()
+	require.NoError(t, s2.SetPersistentCache(path, key))
+	s2.ErrorProvider("remote", errors.New("source is down"))
+	i, err := s2.GetItem("password")
+	require.NoError(t, err)
+	assert.Equal(t, "s3cr3t", i.value)
+	assert.True(t, i.Sensitive())
+	assert.True(t, i.Stale())
+
+	// values encrypted with another key are dropped
+	s3 := NewStore()
+	defer s3.Close()
+	require.NoError(t, s3.SetPersistentCache(path, []byte("fedcba9876543210fedcba9876543210")))
+	s3.ErrorProvider("remote", errors.New("source is down"))
+	_, err = s3.GetItem("password")
+	assert.ErrorIs(t, err, ErrNotFound)
+	v, err := s3.GetItemValue("foo")
+	require.NoError(t, err)
+	assert.Equal(t, "bar", v)
+
+	assert.Error(t, s3.SetPersistentCache(path, []byte("short")))
+}
+
+func TestPersistentCacheFailedProviders(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.json")
+
+	s := NewStore()
+	defer s.Close()
+	require.NoError(t, s.SetPersistentCache(path, nil))
+	s.InMemory("local").Add(NewItem("foo", "saved", 0))
+	s.InMemory("remote").Add(NewItem("bar", "saved", 0))
+	_, err := s.GetItemList()
+	require.NoError(t, err)
+
+	// only the failed provider is replaced by its saved items
+	s2 := NewStore()
+	defer s2.Close()
+	require.NoError(t, s2.SetPersistentCache(path, nil))
+	s2.InMemory("local").Add(NewItem("foo", "fresh", 0))
+	s2.ErrorProvider("remote", errors.New("source is down"))
+	i, err := s2.GetItem("foo")
+	require.NoError(t, err)
+	assert.Equal(t, "fresh", i.value)
+	assert.False(t, i.Stale())
+	i, err = s2.GetItem("bar")
+	require.NoError(t, err)
+	assert.Equal(t, "saved", i.value)
+	assert.True(t, i.Stale())
+
+	// the cache file is only read once
+	require.NoError(t, os.Remove(path))
+	v, err := s2.GetItemValue("bar")
+	require.NoError(t, err)
+	assert.Equal(t, "saved", v)
+}
@@ -0,0 +1,164 @@
+package configstore
+
+import (
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// A Layer is a named band of priorities. All the items of a provider registered in a layer get a priority
+// within the layer band, so that they take precedence over the items of lower layers regardless of the
+// priorities returned by the providers: defaults < files < env < flags < overrides.
+type Layer int64
+
+const (
+	// LayerNone leaves the item priorities as returned by the provider.
+	LayerNone Layer = iota
+	// LayerDefaults is meant for hardcoded or packaged default values.
+	LayerDefaults
+	// LayerFiles is meant for configuration files.
+	LayerFiles
+	// LayerEnv is meant for environment variables.
+	LayerEnv
+	// LayerFlags is meant for command-line flags.
+	LayerFlags
+	// LayerOverrides is meant for local overrides, which beat everything else.
+	LayerOverrides
+)
+
+// LayerSpan is the width of the band of priorities of each layer.
+// The items of a provider in layer L get a priority within [L*LayerSpan, (L+1)*LayerSpan).
+const LayerSpan = 1000
+
+var layerNames = map[Layer]string{
+	LayerNone:      "none",
+	LayerDefaults:  "defaults",
+	LayerFiles:     "files",
+	LayerEnv:       "env",
+	LayerFlags:     "flags",
+	LayerOverrides: "overrides",
+}
+
+// String returns the layer name.
+func (l Layer) String() string {
+	if name, ok := layerNames[l]; ok {
+		return name
+	}
+	return fmt.Sprintf("layer(%d)", int64(l))
+}
+
+// ParseLayer returns the layer matching a name (defaults, files, env, flags, overrides).
+func ParseLayer(name string) (Layer, error) {
+	for l, n := range layerNames {
+		if strings.EqualFold(n, name) {
+			return l, nil
+		}
+	}
+	return LayerNone, fmt.Errorf("unknown priority layer '%s'", name)
+}
+
+// priorityRule describes how the priorities of the items returned by a provider are adjusted.
+type priorityRule struct {
+	offset   int64
+	min, max *int64
+	layer    Layer
+}
+
+func (r priorityRule) isZero() bool {
+	return r.offset == 0 && r.min == nil && r.max == nil && r.layer == LayerNone
+}
+
+// adjust returns the adjusted priority: offset, then clamp, then layer band.
+func (r priorityRule) adjust(priority int64) int64 {
+	priority += r.offset
+	if r.min != nil && priority < *r.min {
+		priority = *r.min
+	}
+	if r.max != nil && priority > *r.max {
+		priority = *r.max
+	}
+	if r.layer != LayerNone {
+		priority = min(max(priority, 0), LayerSpan-1)
+		priority += int64(r.layer) * LayerSpan
+	}
+	return priority
+}
+
+// PriorityOffset adds an offset to the priority of all the items returned by the provider.
+func PriorityOffset(offset int64) ProviderOption {
+	return func(o *providerOptions) {
+		o.priority.offset = offset
+	}
+}
+
+// PriorityClamp restricts the priority of all the items returned by the provider to [min, max].
+func PriorityClamp(min, max int64) ProviderOption {
+	return func(o *providerOptions) {
+		o.priority.min = &min
+		o.priority.max = &max
+	}
+}
+
+// Priority forces the priority of all the items returned by the provider.
+func Priority(priority int64) ProviderOption {
+	return PriorityClamp(priority, priority)
+}
+
+// InLayer puts the provider in a priority layer. The offset and clamp options are applied first,
+// then the priorities are restricted to the layer band. See Layer.
+func InLayer(layer Layer) ProviderOption {
+	return func(o *providerOptions) {
+		o.priority.layer = layer
+	}
+}
+
+// priorityOptions lists the ConfigEnvVar options which are handled for all factories.
+var priorityOptions = []string{"priority", "priority-offset", "priority-min", "priority-max", "layer"}
+
+// priorityRule extracts the priority options from the spec:
+// priority=<n>, priority-offset=<n>, priority-min=<n>, priority-max=<n> and layer=<name>.
+func (p ProviderSpec) priorityRule() (priorityRule, ProviderSpec, error) {
+	var rule priorityRule
+
+	intOption := func(name string) (*int64, error) {
+		if _, ok := p.Options[name]; !ok {
+			return nil, nil
+		}
+		v, err := p.IntOption(name, 0)
+		return &v, err
+	}
+
+	var err error
+	if rule.offset, err = p.IntOption("priority-offset", 0); err != nil {
+		return rule, p, err
+	}
+	if rule.min, err = intOption("priority-min"); err != nil {
+		return rule, p, err
+	}
+	if rule.max, err = intOption("priority-max"); err != nil {
+		return rule, p, err
+	}
+	fixed, err := intOption("priority")
+	if err != nil {
+		return rule, p, err
+	}
+	if fixed != nil {
+		rule.min, rule.max = fixed, fixed
+	}
+	if v := p.Option("layer"); v != "" {
+		if rule.layer, err = ParseLayer(v); err != nil {
+			return rule, p, fmt.Errorf("option 'layer': %w", err)
+		}
+	}
+
+	remaining := url.Values{}
+	for k, v := range p.Options {
+		if !slices.Contains(priorityOptions, k) {
+			remaining[k] = v
+		}
+	}
+	p.Options = remaining
+
+	return rule, p, nil
+}
@@ -0,0 +1,120 @@
+package configstore
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPriorityRule(t *testing.T) {
+	assert.Equal(t, int64(15), priorityRule{offset: 5}.adjust(10))
+
+	lo, hi := int64(0), int64(20)
+	clamp := priorityRule{min: &lo, max: &hi}
+	assert.Equal(t, int64(0), clamp.adjust(-3))
+	assert.Equal(t, int64(20), clamp.adjust(50))
+
+	assert.Equal(t, int64(3010), priorityRule{layer: LayerEnv}.adjust(10))
+	assert.Equal(t, int64(3999), priorityRule{layer: LayerEnv}.adjust(5000))
+	assert.Equal(t, int64(3000), priorityRule{layer: LayerEnv}.adjust(-5))
+	assert.Equal(t, int64(2100), priorityRule{offset: 100, layer: LayerFiles}.adjust(0))
+}
+
+func TestPriorityLayers(t *testing.T) {
+	s := NewStore()
+	defer s.Close()
+
+	defaults := []Item{NewItem("foo", "default", 100), NewItem("bar", "default", 100)}
+	s.InMemory("defaults", InLayer(LayerDefaults)).Add(defaults...)
+	s.InMemory("overrides", InLayer(LayerOverrides)).Add(NewItem("foo", "override", 0))
+	s.RegisterProvider("files", func() (ItemList, error) {
+		return ItemList{Items: []Item{NewItem("foo", "file", 5), NewItem("bar", "file", -10)}}, nil
+	}, InLayer(LayerFiles))
+
+	v, err := Filter().Store(s).Squash().GetItemValue("foo")
+	require.NoError(t, err)
+	assert.Equal(t, "override", v)
+	v, err = Filter().Store(s).Squash().GetItemValue("bar")
+	require.NoError(t, err)
+	assert.Equal(t, "file", v)
+
+	i, err := Filter().Store(s).Squash().GetItem("bar")
+	require.NoError(t, err)
+	assert.Equal(t, int64(2000), i.Priority())
+
+	// the provider data is left untouched
+	assert.Equal(t, int64(100), defaults[0].Priority())
+}
+
+func TestPriorityOptions(t *testing.T) {
+	s := NewStore()
+	defer s.Close()
+
+	s.InMemory("low", PriorityOffset(-10)).Add(NewItem("foo", "low", 15))
+	s.InMemory("high", Priority(7)).Add(NewItem("foo", "high", 1))
+	s.InMemory("clamped", PriorityClamp(0, 6)).Add(NewItem("foo", "clamped", 50))
+
+	i, err := Filter().Store(s).Squash().GetItem("foo")
+	require.NoError(t, err)
+	assert.Equal(t, "high", i.value)
+	assert.Equal(t, int64(7), i.Priority())
+}
+
+func TestPriorityFromEnvironment(t *testing.T) {
+	t.Setenv("CONFIGSTORE_PRIOTEST_FOO", "env")
+	t.Setenv(ConfigEnvVar, "env:CONFIGSTORE_PRIOTEST?layer=defaults,file:tests/fixtures/fileprovider/test.yaml?priority-offset=-1000&layer=files")
+
+	s := NewStore()
+	defer s.Close()
+	require.NoError(t, s.InitFromEnvironment())
+
+	i, err := Filter().Store(s).Squash().GetItem("foo")
+	require.NoError(t, err)
+	assert.Equal(t, "env", i.value)
+	assert.Equal(t, int64(1015), i.Priority())
+
+	i, err = s.GetItem("my-config-key-1")
+	require.NoError(t, err)
+	assert.Equal(t, int64(2000), i.Priority())
+
+	t.Setenv(ConfigEnvVar, "env:CONFIGSTORE_PRIOTEST?layer=bogus,env:OTHER?priority=high")
+	s2 := NewStore()
+	defer s2.Close()
+	err = s2.InitFromEnvironment()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "unknown priority layer 'bogus'")
+	assert.Contains(t, err.Error(), "invalid integer 'high'")
+}
+
+func init() {
+	RegisterProviderFactoryInfo(ProviderFactoryInfo{
+		Name: "priotest",
+		Factory: func(s *Store, spec ProviderSpec) error {
+			var opts []ProviderOption
+			if spec.Arg == "forward" {
+				opts = spec.ProviderOptions()
+			}
+			s.InMemory("priotest:"+spec.Arg, opts...).Add(NewItem("priotest-"+spec.Arg, "value", 10))
+			return nil
+		},
+	})
+}
+
+func TestPriorityFromEnvironmentFactory(t *testing.T) {
+	t.Setenv(ConfigEnvVar, "priotest:forward?priority-offset=5")
+	s := NewStore()
+	defer s.Close()
+	require.NoError(t, s.InitFromEnvironment())
+	i, err := s.GetItem("priotest-forward")
+	require.NoError(t, err)
+	assert.Equal(t, int64(15), i.Priority())
+
+	// a factory which does not apply the options fails, instead of ignoring them
+	t.Setenv(ConfigEnvVar, "priotest:ignore?priority-offset=5")
+	s = NewStore()
+	defer s.Close()
+	assert.Error(t, s.InitFromEnvironment())
+	_, err = s.GetItemList()
+	assert.Error(t, err)
+}
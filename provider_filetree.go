@@ -1,6 +1,7 @@
 package configstore
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
 	"unicode"
@@ -9,40 +10,49 @@ import (
 	"github.com/fsnotify/fsnotify"
 )
 
-func fileTreeProvider(s *Store, dirname string) {
-	fileTree(s, dirname, false)
-}
-
-func fileTreeRefreshProvider(s *Store, dirname string) {
-	fileTree(s, dirname, true)
+func fileTreeFactory(refresh refreshMode) ProviderFactoryFunc {
+	return func(s *Store, spec ProviderSpec) error {
+		opts, err := specProviderOptions(spec, refresh)
+		if err != nil {
+			errorProvider(s, buildProviderName("filetree", opts, spec.Arg), err)
+			return err
+		}
+		return fileTree(s, spec.Arg, opts)
+	}
 }
 
-func fileTree(s *Store, dirname string, refresh bool) {
+func fileTree(s *Store, dirname string, opts providerOptions) error {
 	if dirname == "" {
-		return
+		return nil
 	}
 
-	providername := buildProviderName("filetree", refresh, dirname)
+	providername := buildProviderName("filetree", opts, dirname)
 
-	items, err := loadItems(dirname)
+	l := newLoader(s, &InMemoryProvider{}, func() ([]Item, error) { return loadItems(dirname) }, opts)
+	items, err := l.load()
 	if err != nil {
-		errorProvider(s, providername, err)
-		return
+		// the provider fails until the tree is reloaded successfully
+		logError(err)
+		l.fail(err)
+	} else {
+		l.set(items)
 	}
+	l.register(providername)
 
-	inmem := inMemoryProvider(s, providername)
-	inmem.mut.Lock()
-	inmem.items = items
-	inmem.mut.Unlock()
-
-	if !refresh {
-		return
-	}
+	l.watch(providername, dirname, opts, watchTree)
+	return err
+}
 
+// watchTree calls onChange every time a file is created, written to or removed in the directory hierarchy.
+func watchTree(s *Store, dirname string, onChange func()) error {
 	watcher, err := fsnotify.NewWatcher()
 	if err != nil {
-		errorProvider(s, providername, err)
-		return
+		return err
+	}
+
+	if err := watchDirectory(watcher, dirname); err != nil {
+		_ = watcher.Close()
+		return err
 	}
 
 	go func() {
@@ -78,15 +88,7 @@ func fileTree(s *Store, dirname string, refresh bool) {
 					_ = watcher.Remove(event.Name)
 				}
 
-				items, err := loadItems(dirname)
-				if err != nil {
-					logError(err)
-				} else {
-					inmem.mut.Lock()
-					inmem.items = items
-					inmem.mut.Unlock()
-					s.NotifyWatchers()
-				}
+				onChange()
 
 			case err, ok := <-watcher.Errors:
 				if !ok {
@@ -97,9 +99,7 @@ func fileTree(s *Store, dirname string, refresh bool) {
 		}
 	}()
 
-	if err := watchDirectory(watcher, dirname); err != nil {
-		errorProvider(s, providername, err)
-	}
+	return nil
 }
 
 func loadItems(dirname string) ([]Item, error) {
@@ -108,14 +108,26 @@ func loadItems(dirname string) ([]Item, error) {
 		return nil, err
 	}
 
+	meta, err := readDirMeta(dirname, fileTreeMeta{})
+	if err != nil {
+		return nil, err
+	}
+
 	var items []Item
 	for _, f := range files {
+		if isMetaFile(dirname, f.Name()) {
+			continue
+		}
 		filename := filepath.Join(dirname, f.Name())
 		fi, err := f.Info()
 		if err != nil {
 			return nil, err
 		}
-		subitems, err := walk(filename, fi)
+		fileMeta, err := readSidecarMeta(filename, meta)
+		if err != nil {
+			return nil, err
+		}
+		subitems, err := walk(filename, fi, fileMeta)
 		if err != nil {
 			return nil, err
 		}
@@ -159,12 +171,12 @@ func watchDirectory(watcher *fsnotify.Watcher, root string) error {
 	})
 }
 
-func walk(filename string, f os.FileInfo) ([]Item, error) {
+func walk(filename string, f os.FileInfo, meta fileTreeMeta) ([]Item, error) {
 	if isDirOrSymlinkDir(filename, f) {
-		return browseDir([]Item{}, filename, f.Name())
+		return browseDir([]Item{}, filename, f.Name(), meta)
 	}
 
-	it, err := readItem(filename, f.Name())
+	it, err := readItem(filename, f.Name(), meta)
 	it.key = transformKey(f.Name())
 	if err != nil {
 		return nil, err
@@ -172,20 +184,31 @@ func walk(filename string, f os.FileInfo) ([]Item, error) {
 	return []Item{it}, nil
 }
 
-func browseDir(items []Item, path, basename string) ([]Item, error) {
+func browseDir(items []Item, path, basename string, parentMeta fileTreeMeta) ([]Item, error) {
 	files, err := os.ReadDir(path)
 	if err != nil {
 		return items, err
 	}
+	meta, err := readDirMeta(path, parentMeta)
+	if err != nil {
+		return items, err
+	}
 	for _, f := range files {
+		if isMetaFile(path, f.Name()) {
+			continue
+		}
 		filename := filepath.Join(path, f.Name())
 		fi, err := f.Info()
 		if err != nil {
 			return nil, err
 		}
+		fileMeta, err := readSidecarMeta(filename, meta)
+		if err != nil {
+			return nil, err
+		}
 		if isDirOrSymlinkDir(filename, fi) {
 			var subItems []Item
-			subItems, err = browseDir(subItems, filename, filepath.Join(basename, f.Name()))
+			subItems, err = browseDir(subItems, filename, filepath.Join(basename, f.Name()), fileMeta)
 			if err != nil {
 				return nil, err
 			}
@@ -193,32 +216,44 @@ func browseDir(items []Item, path, basename string) ([]Item, error) {
 			continue
 		}
 
-		it1, err := readItem(filename, basename)
+		it1, err := readItem(filename, basename, fileMeta)
 		if err != nil {
 			return items, err
 		}
 		items = append(items, it1)
 
-		it2 := newItem(filepath.Join(basename, f.Name()), it1.value)
+		it2 := newItem(filepath.Join(basename, f.Name()), it1.value, fileMeta)
 		items = append(items, it2)
 	}
 
 	return items, nil
 }
 
-func readItem(path, basename string) (Item, error) {
+func readItem(path, basename string, meta fileTreeMeta) (Item, error) {
 	content, err := os.ReadFile(path)
 	if err != nil {
 		return Item{}, err
 	}
-	return newItem(basename, string(content)), nil
+	value, err := meta.decode(content)
+	if err != nil {
+		return Item{}, fmt.Errorf("%s: %w", path, err)
+	}
+	return newItem(basename, value, meta), nil
 }
 
-func newItem(name, content string) Item {
+func newItem(name, content string, meta fileTreeMeta) Item {
 	priority := int64(5)
 	first, _ := utf8.DecodeRuneInString(name)
 	if unicode.IsUpper(first) {
 		priority = 10
 	}
-	return NewItem(name, content, priority)
+	if meta.Priority != nil {
+		priority = *meta.Priority
+	}
+	it := NewItem(name, content, priority)
+	if meta.Sensitive != nil {
+		it.sensitive = *meta.Sensitive
+	}
+	it.description = meta.Description
+	return it
 }
@@ -0,0 +1,114 @@
+package configstore
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ghodss/yaml"
+)
+
+const (
+	// FileTreeDirMetaFile is the name of the optional file holding the metadata applied to every file of a FileTree directory
+	// (and of its sub-directories).
+	FileTreeDirMetaFile = ".configstore.yaml"
+	// FileTreeMetaSuffix is appended to a file (or sub-directory) name to build the name of its sidecar metadata file,
+	// e.g. "foo.meta.yaml" holds the metadata of "foo".
+	FileTreeMetaSuffix = ".meta.yaml"
+)
+
+const (
+	fileTreeEncodingRaw    = "raw"
+	fileTreeEncodingBase64 = "base64"
+)
+
+// fileTreeMeta holds the metadata which can be attached to the files of a FileTree.
+// Unset fields are inherited from the enclosing directory.
+type fileTreeMeta struct {
+	Priority    *int64 `json:"priority,omitempty"`
+	Sensitive   *bool  `json:"sensitive,omitempty"`
+	Encoding    string `json:"encoding,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+// merge returns a copy of m, overridden by the fields set in o.
+func (m fileTreeMeta) merge(o fileTreeMeta) fileTreeMeta {
+	if o.Priority != nil {
+		m.Priority = o.Priority
+	}
+	if o.Sensitive != nil {
+		m.Sensitive = o.Sensitive
+	}
+	if o.Encoding != "" {
+		m.Encoding = o.Encoding
+	}
+	if o.Description != "" {
+		m.Description = o.Description
+	}
+	return m
+}
+
+// decode turns the raw content of a file into an item value, according to the content encoding.
+func (m fileTreeMeta) decode(content []byte) (string, error) {
+	switch strings.ToLower(m.Encoding) {
+	case "", fileTreeEncodingRaw:
+		return string(content), nil
+	case fileTreeEncodingBase64:
+		b, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(content)))
+		if err != nil {
+			return "", err
+		}
+		return string(b), nil
+	}
+	return "", fmt.Errorf("unknown content encoding '%s'", m.Encoding)
+}
+
+func readMetaFile(filename string) (fileTreeMeta, bool, error) {
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return fileTreeMeta{}, false, nil
+		}
+		return fileTreeMeta{}, false, err
+	}
+	var meta fileTreeMeta
+	if err := yaml.Unmarshal(b, &meta); err != nil {
+		return fileTreeMeta{}, false, fmt.Errorf("%s: %w", filename, err)
+	}
+	return meta, true, nil
+}
+
+// readDirMeta returns the metadata applying to the files of a directory: the directory-level metadata file
+// (if any) merged on top of the metadata inherited from its parent.
+func readDirMeta(dirname string, parent fileTreeMeta) (fileTreeMeta, error) {
+	meta, ok, err := readMetaFile(filepath.Join(dirname, FileTreeDirMetaFile))
+	if err != nil || !ok {
+		return parent, err
+	}
+	return parent.merge(meta), nil
+}
+
+// readSidecarMeta returns the metadata applying to a single file or sub-directory: its sidecar metadata file
+// (if any) merged on top of the directory metadata.
+func readSidecarMeta(filename string, dirMeta fileTreeMeta) (fileTreeMeta, error) {
+	meta, ok, err := readMetaFile(filename + FileTreeMetaSuffix)
+	if err != nil || !ok {
+		return dirMeta, err
+	}
+	return dirMeta.merge(meta), nil
+}
+
+// isMetaFile reports whether a directory entry holds metadata rather than an item.
+// A "*.meta.yaml" file is only considered as a sidecar if the file it describes exists.
+func isMetaFile(dirname, name string) bool {
+	if name == FileTreeDirMetaFile {
+		return true
+	}
+	if !strings.HasSuffix(name, FileTreeMetaSuffix) {
+		return false
+	}
+	_, err := os.Stat(filepath.Join(dirname, strings.TrimSuffix(name, FileTreeMetaSuffix)))
+	return err == nil
+}
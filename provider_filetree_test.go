@@ -187,3 +187,47 @@ func TestFileTreeProviderWithSymbolicLinks(t *testing.T) {
 	require.NoError(t, err)
 	require.Equal(t, "prod foo value", v)
 }
+
+func TestFileTreeProviderWithMetadata(t *testing.T) {
+	var s = NewStore()
+	s.FileTree("tests/fixtures/filetreeprovider4")
+
+	l, err := s.GetItemList()
+	require.NoError(t, err)
+
+	require.Equal(t, 8, l.Len())
+
+	foo, err := l.GetItem("foo")
+	require.NoError(t, err)
+	require.Equal(t, "foo value", mustValue(foo))
+	require.Equal(t, int64(20), foo.Priority())
+	require.Equal(t, "the foo item", foo.Description())
+	require.False(t, foo.Sensitive())
+
+	secret, err := l.GetItem("secret")
+	require.NoError(t, err)
+	require.Equal(t, "secret value", mustValue(secret))
+	require.Equal(t, int64(5), secret.Priority())
+	require.True(t, secret.Sensitive())
+
+	plain, err := l.GetItem("plain")
+	require.NoError(t, err)
+	require.Equal(t, "tree defaults", plain.Description())
+
+	orphan, err := l.GetItem("orphan.meta.yaml")
+	require.NoError(t, err)
+	require.Equal(t, "orphan value", mustValue(orphan))
+
+	dbItems, has := l.indexed["db"]
+	require.True(t, has, "missing 'db' items")
+	require.Len(t, dbItems, 2, "there must be 2 'db' items")
+	require.Equal(t, "b value", dbItems[0].value)
+	require.Equal(t, int64(40), dbItems[0].Priority())
+	require.Equal(t, "a value", dbItems[1].value)
+	require.Equal(t, int64(30), dbItems[1].Priority())
+
+	dbA, err := l.GetItem("db/a")
+	require.NoError(t, err)
+	require.Equal(t, int64(30), dbA.Priority())
+	require.Equal(t, "tree defaults", dbA.Description())
+}
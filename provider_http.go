@@ -0,0 +1,249 @@
+package configstore
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultHTTPTimeout is the timeout of the requests made by the http provider, when none is specified.
+var DefaultHTTPTimeout = 30 * time.Second
+
+// HTTPConfig configures the http provider, see Store.HTTP.
+type HTTPConfig struct {
+	// Client is the HTTP client used to fetch the document. If nil, a client is built from the other fields.
+	Client *http.Client
+	// TLSConfig is used for https URLs, e.g. for mutual TLS authentication. Ignored if Client is set.
+	TLSConfig *tls.Config
+	// Timeout is the timeout of each request (DefaultHTTPTimeout by default). Ignored if Client is set.
+	Timeout time.Duration
+	// Header holds additional request headers.
+	Header http.Header
+	// BearerToken is sent in the Authorization header.
+	BearerToken string
+	// BearerTokenFile is the path of a file holding the bearer token. It is read before each request,
+	// so that the token can be rotated.
+	BearerTokenFile string
+	// Format is the name of the decoder used to read the document (see RegisterDecoder).
+	// By default, it is detected from the response content type, then from the URL extension.
+	Format string
+}
+
+func (c HTTPConfig) client() *http.Client {
+	if c.Client != nil {
+		return c.Client
+	}
+	timeout := c.Timeout
+	if timeout <= 0 {
+		timeout = DefaultHTTPTimeout
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if c.TLSConfig != nil {
+		transport.TLSClientConfig = c.TLSConfig
+	}
+	return &http.Client{Transport: transport, Timeout: timeout}
+}
+
+// httpSource fetches a document with conditional requests (ETag, Last-Modified),
+// so that polling an unchanged document is cheap.
+type httpSource struct {
+	url    string
+	cfg    HTTPConfig
+	client *http.Client
+
+	mut          sync.Mutex
+	etag         string
+	lastModified string
+	items        []Item
+}
+
+func newHTTPSource(url string, cfg HTTPConfig) *httpSource {
+	return &httpSource{url: url, cfg: cfg, client: cfg.client()}
+}
+
+func (h *httpSource) load(ctx context.Context) ([]Item, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, h.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range h.cfg.Header {
+		req.Header[k] = v
+	}
+	token := h.cfg.BearerToken
+	if h.cfg.BearerTokenFile != "" {
+		b, err := os.ReadFile(h.cfg.BearerTokenFile)
+		if err != nil {
+			return nil, err
+		}
+		token = strings.TrimSpace(string(b))
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	h.mut.Lock()
+	if h.etag != "" {
+		req.Header.Set("If-None-Match", h.etag)
+	}
+	if h.lastModified != "" {
+		req.Header.Set("If-Modified-Since", h.lastModified)
+	}
+	h.mut.Unlock()
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotModified:
+		h.mut.Lock()
+		defer h.mut.Unlock()
+		return h.items, nil
+	case http.StatusNotFound:
+		return nil, fmt.Errorf("%s: %w", h.url, fs.ErrNotExist)
+	default:
+		return nil, fmt.Errorf("%s: unexpected status: %s", h.url, resp.Status)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	items, err := Decode(h.cfg.Format, resp.Header.Get("Content-Type"), req.URL.Path, body)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", h.url, err)
+	}
+
+	h.mut.Lock()
+	defer h.mut.Unlock()
+	h.etag = resp.Header.Get("ETag")
+	h.lastModified = resp.Header.Get("Last-Modified")
+	h.items = items
+	return items, nil
+}
+
+func httpFactory(scheme string, refresh refreshMode) ProviderFactoryFunc {
+	return func(s *Store, spec ProviderSpec) error {
+		url := spec.Arg
+		if strings.HasPrefix(url, "//") {
+			url = scheme + ":" + url
+		}
+		opts, err := specProviderOptions(spec, refresh)
+		if err != nil {
+			errorProvider(s, buildProviderName("http", opts, url), err)
+			return err
+		}
+		cfg, err := specHTTPConfig(spec)
+		if err != nil {
+			errorProvider(s, buildProviderName("http", opts, url), err)
+			return err
+		}
+		return httpProvider(s, url, cfg, opts)
+	}
+}
+
+// specHTTPConfig reads the options of an http provider spec.
+func specHTTPConfig(spec ProviderSpec) (HTTPConfig, error) {
+	cfg := HTTPConfig{
+		Format:          spec.Option("format"),
+		BearerTokenFile: spec.Option("bearer-token-file"),
+	}
+	var err error
+	cfg.Timeout, err = spec.DurationOption("timeout", 0)
+	if err != nil {
+		return cfg, err
+	}
+	if cfg.Format != "" {
+		if _, err := getDecoder(cfg.Format); err != nil {
+			return cfg, fmt.Errorf("option 'format': %w", err)
+		}
+	}
+
+	cert, key, ca := spec.Option("cert"), spec.Option("key"), spec.Option("ca")
+	if cert == "" && key == "" && ca == "" {
+		return cfg, nil
+	}
+	cfg.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	if cert != "" || key != "" {
+		pair, err := tls.LoadX509KeyPair(cert, key)
+		if err != nil {
+			return cfg, fmt.Errorf("options 'cert' and 'key': %w", err)
+		}
+		cfg.TLSConfig.Certificates = []tls.Certificate{pair}
+	}
+	if ca != "" {
+		b, err := os.ReadFile(ca)
+		if err != nil {
+			return cfg, fmt.Errorf("option 'ca': %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(b) {
+			return cfg, fmt.Errorf("option 'ca': no certificate found in %s", ca)
+		}
+		cfg.TLSConfig.RootCAs = pool
+	}
+	return cfg, nil
+}
+
+func httpProvider(s *Store, url string, cfg HTTPConfig, opts providerOptions) error {
+	if url == "" {
+		return nil
+	}
+
+	providername := buildProviderName("http", opts, url)
+
+	src := newHTTPSource(url, cfg)
+	l := newLoader(s, &InMemoryProvider{}, func() ([]Item, error) { return src.load(s.ctx) }, opts)
+	vals, err := l.load()
+	if err != nil {
+		if opts.refresh == refreshNone {
+			errorProvider(s, providername, err)
+			return err
+		}
+		// keep polling, the provider fails until the document is fetched
+		logError(err)
+		l.fail(err)
+	} else {
+		if LogInfoFunc != nil {
+			LogInfoFunc("configuration from url: %s", url)
+		}
+		l.set(vals)
+	}
+	l.register(providername)
+
+	// there are no change notifications over HTTP, refreshing always means polling
+	if opts.refresh != refreshNone {
+		l.poll(opts.pollInterval)
+	}
+	return err
+}
+
+// HTTP registers a configstore provider which fetches a document from the given URL (static content).
+// The document format is the same as for the File provider, unless another decoder is selected (see HTTPConfig.Format).
+func (s *Store) HTTP(url string, cfg HTTPConfig, opts ...ProviderOption) {
+	_ = httpProvider(s, url, cfg, providerOptions{}.apply(opts))
+}
+
+// HTTPRefresh is similar to HTTPPoll, using DefaultPollInterval.
+func (s *Store) HTTPRefresh(url string, cfg HTTPConfig, opts ...ProviderOption) {
+	_ = httpProvider(s, url, cfg, providerOptions{refresh: refreshNotify}.apply(opts))
+}
+
+// HTTPPoll registers a configstore provider which fetches a document from the given URL, and polls it at the given interval
+// for auto refresh (watchers get notified when the content changes). Conditional requests (ETag, If-Modified-Since) are used,
+// so that polling an unchanged document is cheap.
+// If the first request fails, the provider fails until the document is fetched.
+func (s *Store) HTTPPoll(url string, cfg HTTPConfig, interval time.Duration, opts ...ProviderOption) {
+	_ = httpProvider(s, url, cfg, providerOptions{refresh: refreshPoll, pollInterval: interval}.apply(opts))
+}
@@ -0,0 +1,184 @@
+package configstore
+
+import (
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ovh/configstore/internal/storetest"
+)
+
+// configServer serves a document, honoring ETag conditional requests.
+type configServer struct {
+	mut      sync.Mutex
+	body     string
+	etag     string
+	requests int32
+	notMod   int32
+	auth     string
+}
+
+func (c *configServer) set(body, etag string) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	c.body, c.etag = body, etag
+}
+
+func (c *configServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	atomic.AddInt32(&c.requests, 1)
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	c.auth = r.Header.Get("Authorization")
+	if c.body == "" {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Header.Get("If-None-Match") == c.etag {
+		atomic.AddInt32(&c.notMod, 1)
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("ETag", c.etag)
+	if strings.HasSuffix(r.URL.Path, ".kv") {
+		w.Header().Set("Content-Type", "text/plain")
+	} else {
+		w.Header().Set("Content-Type", "application/json")
+	}
+	_, _ = w.Write([]byte(c.body))
+}
+
+func TestHTTPProvider(t *testing.T) {
+	cs := &configServer{}
+	cs.set(`[{"key":"foo","value":"bar","priority":3}]`, `"v1"`)
+	srv := httptest.NewServer(cs)
+	defer srv.Close()
+
+	s := NewStore()
+	defer s.Close()
+	ch := s.Watch()
+	s.HTTPPoll(srv.URL+"/app", HTTPConfig{BearerToken: "t0ken"}, 10*time.Millisecond)
+	<-ch
+
+	i, err := s.GetItem("foo")
+	require.NoError(t, err)
+	assert.Equal(t, "bar", i.value)
+	assert.Equal(t, int64(3), i.Priority())
+	cs.mut.Lock()
+	assert.Equal(t, "Bearer t0ken", cs.auth)
+	cs.mut.Unlock()
+
+	// unchanged documents are not downloaded again, and do not notify
+	require.Eventually(t, func() bool { return atomic.LoadInt32(&cs.notMod) >= 3 }, 5*time.Second, 10*time.Millisecond)
+	select {
+	case <-ch:
+		require.FailNow(t, "unexpected notification")
+	default:
+	}
+
+	cs.set(`[{"key":"foo","value":"baz"}]`, `"v2"`)
+	storetest.WaitNotification(t, ch)
+	v, err := s.GetItemValue("foo")
+	require.NoError(t, err)
+	assert.Equal(t, "baz", v)
+	assert.True(t, s.ProviderStatus()["http+poll:"+srv.URL+"/app"].Watching)
+}
+
+func TestHTTPProviderUnavailable(t *testing.T) {
+	cs := &configServer{}
+	srv := httptest.NewServer(cs)
+	defer srv.Close()
+
+	s := NewStore()
+	defer s.Close()
+	s.HTTP(srv.URL+"/static", HTTPConfig{})
+	s.HTTP(srv.URL+"/optional", HTTPConfig{}, Optional())
+	s.HTTPPoll(srv.URL+"/later", HTTPConfig{}, 10*time.Millisecond)
+	_, err := s.GetItemList()
+	require.Error(t, err)
+	var provErrs ErrProviders
+	require.ErrorAs(t, err, &provErrs)
+	assert.Len(t, provErrs, 2)
+
+	// polling providers recover once the document is available
+	s.UnregisterProvider("http:" + srv.URL + "/static")
+	cs.set(`[{"key":"foo","value":"bar"}]`, `"v1"`)
+	require.Eventually(t, func() bool {
+		_, err := s.GetItemList()
+		return err == nil
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func init() {
+	RegisterDecoder("kv", func(b []byte) ([]Item, error) {
+		var items []Item
+		for _, line := range strings.Split(strings.TrimSpace(string(b)), "\n") {
+			k, v, _ := strings.Cut(line, "=")
+			items = append(items, NewItem(k, v, 0))
+		}
+		return items, nil
+	})
+}
+
+func TestHTTPDecoders(t *testing.T) {
+	assert.Contains(t, ListDecoders(), "kv")
+	assert.Equal(t, "json", detectFormat("application/json; charset=utf-8", "/a"))
+	assert.Equal(t, "yaml", detectFormat("", "/a.yml"))
+	assert.Equal(t, "kv", detectFormat("text/plain", "/a.kv"))
+
+	cs := &configServer{}
+	cs.set("foo=bar\nbaz=buz\n", `"v1"`)
+	srv := httptest.NewServer(cs)
+	defer srv.Close()
+
+	t.Setenv(ConfigEnvVar, "http:"+srv.URL+"/app.kv,http:"+srv.URL+"/other?format=kv")
+	s := NewStore()
+	defer s.Close()
+	require.NoError(t, s.InitFromEnvironment())
+	items, err := s.GetItemList()
+	require.NoError(t, err)
+	assert.Len(t, items.Items, 4)
+
+	t.Setenv(ConfigEnvVar, "http:"+srv.URL+"/app?format=toml")
+	err = NewStore().InitFromEnvironment()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "unknown format 'toml'")
+}
+
+func TestHTTPSFactory(t *testing.T) {
+	cs := &configServer{}
+	cs.set(`[{"key":"foo","value":"bar"}]`, `"v1"`)
+	srv := httptest.NewTLSServer(cs)
+	defer srv.Close()
+
+	// the test server certificate is not trusted
+	t.Setenv(ConfigEnvVar, "https:"+strings.TrimPrefix(srv.URL, "https:"))
+	err := NewStore().InitFromEnvironment()
+	require.Error(t, err)
+
+	ca := filepath.Join(t.TempDir(), "ca.pem")
+	require.NoError(t, os.WriteFile(ca, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw}), 0o600))
+	t.Setenv(ConfigEnvVar, "https+refresh:"+strings.TrimPrefix(srv.URL, "https:")+"?ca="+ca+"&interval=1h")
+	s1 := NewStore()
+	defer s1.Close()
+	require.NoError(t, s1.InitFromEnvironment())
+	v, err := s1.GetItemValue("foo")
+	require.NoError(t, err)
+	assert.Equal(t, "bar", v)
+
+	s := NewStore()
+	defer s.Close()
+	s.HTTP(srv.URL, HTTPConfig{Client: srv.Client()})
+	v, err = s.GetItemValue("foo")
+	require.NoError(t, err)
+	assert.Equal(t, "bar", v)
+}
@@ -1,15 +1,14 @@
 package configstore
 
 import (
+	"errors"
 	"fmt"
+	"io/fs"
 	"log"
 	"os"
 	"path/filepath"
 	"strings"
 	"sync"
-
-	"github.com/fsnotify/fsnotify"
-	"github.com/ghodss/yaml"
 )
 
 // Logs functions can be overriden
@@ -37,134 +36,135 @@ func newErrorProvider(err error) Provider {
 	}
 }
 
-func fileProvider(s *Store, filename string) {
-	file(s, filename, false, nil)
-}
-
-func fileRefreshProvider(s *Store, filename string) {
-	file(s, filename, true, nil)
-}
-
-func fileCustomProvider(s *Store, filename string, fn func([]byte) ([]Item, error)) {
-	file(s, filename, false, fn)
-}
-
-func fileCustomRefreshProvider(s *Store, filename string, fn func([]byte) ([]Item, error)) {
-	file(s, filename, true, fn)
+func fileFactory(refresh refreshMode) ProviderFactoryFunc {
+	return func(s *Store, spec ProviderSpec) error {
+		opts, err := specProviderOptions(spec, refresh)
+		if err != nil {
+			errorProvider(s, buildProviderName("file", opts, spec.Arg), err)
+			return err
+		}
+		return file(s, spec.Arg, opts, nil)
+	}
 }
 
-func file(s *Store, filename string, refresh bool, fn func([]byte) ([]Item, error)) {
+func file(s *Store, filename string, opts providerOptions, fn func([]byte) ([]Item, error)) error {
 
 	if filename == "" {
-		return
+		return nil
 	}
 
-	providername := buildProviderName("file", refresh, filename)
+	providername := buildProviderName("file", opts, filename)
 
-	vals, err := readFile(filename, fn)
+	l := newLoader(s, &InMemoryProvider{}, func() ([]Item, error) { return readFile(filename, fn) }, opts)
+	vals, err := l.load()
 	if err != nil {
-		errorProvider(s, providername, err)
-		return
-	}
-	inmem := inMemoryProvider(s, providername)
-	if LogInfoFunc != nil {
-		LogInfoFunc("configuration from file: %s", filename)
+		// the provider fails until the file is reloaded successfully
+		logError(err)
+		l.fail(err)
+	} else {
+		if LogInfoFunc != nil {
+			LogInfoFunc("configuration from file: %s", filename)
+		}
+		l.set(vals)
 	}
-	inmem.Add(vals...)
+	l.register(providername)
 
-	if !refresh {
-		return
-	}
+	l.watch(providername, filename, opts, watchFile)
+	return err
+}
 
-	watcher, err := fsnotify.NewWatcher()
-	if err != nil {
-		errorProvider(s, providername, err)
-		return
-	}
-
-	go func() {
-		defer func(w *fsnotify.Watcher) {
-			_ = w.Close()
-		}(watcher)
-
-		for {
-			select {
-			case <-s.ctx.Done():
-				return
-
-			case event, ok := <-watcher.Events:
-				if !ok {
-					continue
-				}
-
-				if event.Op&fsnotify.Write != 0 {
-					vals, err := readFile(filename, fn)
-					if err != nil {
-						logError(err)
-					} else {
-						inmem.mut.Lock()
-						inmem.items = vals
-						inmem.mut.Unlock()
-						s.NotifyWatchers()
-					}
-				}
-
-			case err, ok := <-watcher.Errors:
-				if !ok {
-					continue
-				}
-				logError(err)
-			}
+func fileListFactory(refresh refreshMode) ProviderFactoryFunc {
+	return func(s *Store, spec ProviderSpec) error {
+		opts, err := specProviderOptions(spec, refresh)
+		if err != nil {
+			errorProvider(s, buildProviderName("filelist", opts, spec.Arg), err)
+			return err
 		}
-	}()
-
-	if err := watcher.Add(filename); err != nil {
-		errorProvider(s, providername, err)
+		return fileList(s, spec.Arg, opts)
 	}
 }
 
-func fileListProvider(s *Store, dirname string) {
-	fileList(s, dirname, false)
-}
+func fileList(s *Store, dirname string, opts providerOptions) error {
+	if dirname == "" {
+		return nil
+	}
 
-func fileListRefreshProvider(s *Store, dirname string) {
-	fileList(s, dirname, true)
-}
+	providername := buildProviderName("filelist", opts, dirname)
 
-func fileList(s *Store, dirname string, refresh bool) {
-	if dirname == "" {
-		return
+	// the directory itself is registered as a provider without items, so that reloading or refreshing it
+	// picks up the new files, and the directory itself if it is optional and does not exist yet
+	fl := &fileListLoader{s: s, dirname: dirname, opts: opts, known: map[string]bool{}}
+	l := newLoader(s, &InMemoryProvider{}, func() ([]Item, error) {
+		_, err := fl.scan()
+		return nil, err
+	}, opts)
+	// registered before the files, so that Reload scans the directory before reloading them
+	l.register(providername)
+	fileErrs, err := fl.scan()
+	if err != nil && !(opts.optional && errors.Is(err, fs.ErrNotExist)) {
+		logError(err)
+		l.fail(err)
+		fileErrs = append(fileErrs, err)
+	} else {
+		l.set(nil)
 	}
 
-	providername := buildProviderName("filelist", refresh, dirname)
+	l.watch(providername, dirname, opts, watchDir)
+	return errors.Join(fileErrs...)
+}
 
-	files, err := os.ReadDir(dirname)
+// fileListLoader registers a file provider for each file of a directory, including the files added later on.
+type fileListLoader struct {
+	s       *Store
+	dirname string
+	opts    providerOptions
+
+	mut   sync.Mutex
+	known map[string]bool
+}
+
+// scan registers the files of the directory which do not have a provider yet, and unregisters the providers
+// of the files which were removed.
+// It returns the errors of the new file providers, and the error reading the directory.
+func (fl *fileListLoader) scan() ([]error, error) {
+	files, err := os.ReadDir(fl.dirname)
 	if err != nil {
-		errorProvider(s, providername, err)
-		return
+		return nil, err
 	}
 
-	for _, file := range files {
-		fi, err := file.Info()
+	fl.mut.Lock()
+	defer fl.mut.Unlock()
+	var errs []error
+	present := make(map[string]bool, len(files))
+	for _, f := range files {
+		filename := filepath.Join(fl.dirname, f.Name())
+		present[filename] = true
+		if fl.known[filename] {
+			continue
+		}
+		fi, err := f.Info()
 		if err != nil {
-			errorProvider(s, providername, err)
-			return
+			errs = append(errs, err)
+			continue
 		}
-		filename := filepath.Join(dirname, file.Name())
-
 		if isDirOrSymlinkDir(filename, fi) {
 			continue
 		}
-		if refresh {
-			fileRefreshProvider(s, filename)
-		} else {
-			fileProvider(s, filename)
+		fl.known[filename] = true
+		if err := file(fl.s, filename, fl.opts, nil); err != nil {
+			errs = append(errs, err)
 		}
 	}
+	for filename := range fl.known {
+		if !present[filename] {
+			delete(fl.known, filename)
+			fl.s.UnregisterProvider(buildProviderName("file", fl.opts, filename))
+		}
+	}
+	return errs, nil
 }
 
 func readFile(filename string, fn func([]byte) ([]Item, error)) ([]Item, error) {
-	var vals []Item
 	b, err := os.ReadFile(filename)
 	if err != nil {
 		return nil, err
@@ -173,16 +173,12 @@ func readFile(filename string, fn func([]byte) ([]Item, error)) ([]Item, error)
 	if fn != nil {
 		return fn(b)
 	}
-	err = yaml.Unmarshal(b, &vals)
-	if err != nil {
-		return nil, err
-	}
-	return vals, nil
+	return decodeItems(b)
 }
 
-func inMemoryProvider(s *Store, name string) *InMemoryProvider {
+func inMemoryProvider(s *Store, name string, opts providerOptions) *InMemoryProvider {
 	inmem := &InMemoryProvider{}
-	s.RegisterProvider(name, inmem.Items)
+	s.registerProvider(name, opts.entry(s, &providerEntry{provider: inmem.Items}))
 	return inmem
 }
 
@@ -200,6 +196,16 @@ func (inmem *InMemoryProvider) Add(s ...Item) *InMemoryProvider {
 	return inmem
 }
 
+// Set replaces the in-memory list, and reports whether its content changed.
+// Providers keeping a local copy of a remote source can use it to notify the watchers only on actual changes.
+func (inmem *InMemoryProvider) Set(s ...Item) bool {
+	inmem.mut.Lock()
+	defer inmem.mut.Unlock()
+	changed := hashItems(s) != hashItems(inmem.items)
+	inmem.items = s
+	return changed
+}
+
 // Items returns the in-memory item list. This is the function that gets called by configstore.
 func (inmem *InMemoryProvider) Items() (ItemList, error) {
 	inmem.mut.Lock()
@@ -207,7 +213,12 @@ func (inmem *InMemoryProvider) Items() (ItemList, error) {
 	return ItemList{Items: inmem.items}, nil
 }
 
-func envProvider(s *Store, prefix string) {
+func envProvider(s *Store, spec ProviderSpec) error {
+	env(s, spec.Arg, providerOptions{}.apply(spec.ProviderOptions()))
+	return nil
+}
+
+func env(s *Store, prefix string, opts providerOptions) {
 
 	if prefix != "" && !strings.HasSuffix(prefix, "_") {
 		prefix += "_"
@@ -217,10 +228,16 @@ func envProvider(s *Store, prefix string) {
 	if prefixName == "" {
 		prefixName = "all"
 	}
-	inmem := inMemoryProvider(s, fmt.Sprintf("env:%s", prefixName))
 
 	prefix = transformKey(prefix)
 
+	l := newLoader(s, &InMemoryProvider{}, func() ([]Item, error) { return readEnv(prefix), nil }, opts)
+	l.set(readEnv(prefix))
+	l.register(fmt.Sprintf("env:%s", prefixName))
+}
+
+func readEnv(prefix string) []Item {
+	var items []Item
 	for _, e := range os.Environ() {
 		ePair := strings.SplitN(e, "=", 2)
 		if len(ePair) <= 1 {
@@ -228,18 +245,18 @@ func envProvider(s *Store, prefix string) {
 		}
 		eTr := transformKey(ePair[0])
 		if strings.HasPrefix(eTr, prefix) {
-			inmem.Add(NewItem(strings.TrimPrefix(eTr, prefix), ePair[1], 15))
+			items = append(items, NewItem(strings.TrimPrefix(eTr, prefix), ePair[1], 15))
 		}
 	}
-
-	// once all items have been added, we need to notify watchers in case the goroutine watching for
-	// providers change already scanned the Items
-	s.NotifyWatchers()
+	return items
 }
 
-func buildProviderName(name string, refresh bool, parameter string) string {
-	if refresh {
+func buildProviderName(name string, opts providerOptions, parameter string) string {
+	switch opts.refresh {
+	case refreshNotify:
 		return fmt.Sprintf("%s+refresh:%s", name, parameter)
+	case refreshPoll:
+		return fmt.Sprintf("%s+poll:%s", name, parameter)
 	}
 	return fmt.Sprintf("%s:%s", name, parameter)
 }
@@ -0,0 +1,388 @@
+// Package redis provides a configstore provider reading a Redis hash, or the string keys sharing a prefix.
+//
+// In hash mode, each field of the hash becomes an item. In prefix mode, each key starting with the prefix becomes an item,
+// named after the key without the prefix. The provider embeds a minimal client of the Redis protocol.
+//
+// Importing the package registers the "redis" provider factory:
+//
+//	CONFIGURATION_FROM=redis:myapp:config?refresh=true&address=redis.internal:6379&password-file=/run/secrets/redis
+//	CONFIGURATION_FROM=redis:myapp:?prefix=true&refresh=poll&interval=30s
+//
+// The refreshing variant subscribes to the keyspace notifications, which must be enabled on the server
+// (notify-keyspace-events must contain "K" and the matching event classes, e.g. "Kgh$"), and coalesces the notifications
+// received within the debounce delay into a single reload. The polling variant re-reads the keys at the given interval.
+// Both reuse a single connection for the reloads, and notify the watchers when the items change.
+package redis
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ovh/configstore"
+)
+
+func init() {
+	options := []string{"address", "username", "password-file", "db", "prefix", "timeout"}
+	for _, variant := range []struct {
+		suffix, description string
+		options             []string
+	}{
+		{"", "Reads a Redis hash, or the keys sharing a prefix.", options},
+		{"+refresh", "Reads a Redis hash, or the keys sharing a prefix, and follows the keyspace notifications.", append([]string{"retry-delay", "debounce"}, options...)},
+		{"+poll", "Reads a Redis hash, or the keys sharing a prefix, and polls them at the given interval.", append([]string{"interval"}, options...)},
+	} {
+		name := "redis" + variant.suffix
+		configstore.RegisterProviderFactoryInfo(configstore.ProviderFactoryInfo{
+			Name:        name,
+			Description: variant.description,
+			Syntax:      name + ":<key>",
+			Examples:    []string{name + ":myapp:config?address=redis.internal:6379"},
+			Options:     variant.options,
+			Factory:     factory(variant.suffix),
+		})
+	}
+}
+
+const (
+	// DefaultAddress is the address of the Redis server, when none is specified.
+	DefaultAddress = "127.0.0.1:6379"
+	// DefaultTimeout is the default timeout of the connections and commands.
+	DefaultTimeout = 5 * time.Second
+	// DefaultRetryDelay is the default delay before subscribing again to the notifications, after a failure.
+	DefaultRetryDelay = time.Second
+	// DefaultDebounce is the default delay during which the keyspace notifications are coalesced into a single reload.
+	DefaultDebounce = 100 * time.Millisecond
+)
+
+// Config configures the redis provider, see Register.
+type Config struct {
+	// Address is the address of the Redis server (DefaultAddress by default).
+	Address string
+	// Username and Password (or PasswordFile) are used to authenticate. The username is only needed with ACLs.
+	Username     string
+	Password     string
+	PasswordFile string
+	// DB is the database number.
+	DB int
+	// TLSConfig enables TLS.
+	TLSConfig *tls.Config
+	// Timeout is the timeout of the connections and commands (DefaultTimeout by default).
+	Timeout time.Duration
+	// Prefix reads the string keys starting with the given key, instead of the hash with the given key.
+	Prefix bool
+	// Priority is the priority of the items.
+	Priority int64
+	// Watch subscribes to the keyspace notifications, and notifies the watchers when the items change.
+	Watch bool
+	// PollInterval, if set, re-reads the keys at that interval, and notifies the watchers when the items change.
+	PollInterval time.Duration
+	// RetryDelay is the delay before subscribing again after a failure (DefaultRetryDelay by default).
+	RetryDelay time.Duration
+	// Debounce is the delay during which the keyspace notifications following a first one are coalesced
+	// into a single reload (DefaultDebounce by default).
+	Debounce time.Duration
+}
+
+func factory(variant string) configstore.ProviderFactoryFunc {
+	return func(s *configstore.Store, spec configstore.ProviderSpec) error {
+		cfg := Config{
+			Address:      spec.Option("address"),
+			Username:     spec.Option("username"),
+			PasswordFile: spec.Option("password-file"),
+			Watch:        variant == "+refresh",
+		}
+		db, err := spec.IntOption("db", 0)
+		cfg.DB = int(db)
+		if err == nil {
+			cfg.Prefix, err = spec.BoolOption("prefix", false)
+		}
+		if err == nil {
+			cfg.Timeout, err = spec.DurationOption("timeout", 0)
+		}
+		if err == nil {
+			cfg.RetryDelay, err = spec.DurationOption("retry-delay", 0)
+		}
+		if err == nil {
+			cfg.Debounce, err = spec.DurationOption("debounce", 0)
+		}
+		if err == nil && variant == "+poll" {
+			cfg.PollInterval, err = spec.DurationOption("interval", configstore.DefaultPollInterval)
+		}
+		if err != nil {
+			s.ErrorProvider("redis:"+spec.Arg, err)
+			return err
+		}
+		return Register(s, spec.Arg, cfg, spec.ProviderOptions()...)
+	}
+}
+
+// client keeps a local copy of the items read from Redis.
+type client struct {
+	*configstore.Remote
+	key string
+	cfg Config
+
+	// only used by the goroutine loading the items: the connection, kept open while following the changes
+	conn *conn
+}
+
+// Register registers a provider reading the hash with the given key (or the keys starting with it, see Config.Prefix),
+// named "redis:<key>". If cfg.Watch or cfg.PollInterval are set, the provider follows the changes until the store
+// is closed, and the watchers get notified when the items change (see configstore.Remote for the handling of failures).
+func Register(s *configstore.Store, key string, cfg Config, opts ...configstore.ProviderOption) error {
+	if cfg.Address == "" {
+		cfg.Address = DefaultAddress
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = DefaultTimeout
+	}
+	if cfg.RetryDelay <= 0 {
+		cfg.RetryDelay = DefaultRetryDelay
+	}
+	if cfg.Debounce <= 0 {
+		cfg.Debounce = DefaultDebounce
+	}
+	c := &client{Remote: s.NewRemote("redis:" + key), key: key, cfg: cfg}
+
+	items, err := c.load(c.Context())
+	if err == nil {
+		c.Set(items...)
+	}
+	err = c.Register(err, cfg.Watch || cfg.PollInterval > 0, opts...)
+	switch {
+	case cfg.Watch:
+		go c.follow(c.Context())
+	case cfg.PollInterval > 0:
+		go c.poll(c.Context())
+	default:
+		c.closeConn()
+	}
+	return err
+}
+
+// closeConn closes the connection used to load the items, if any.
+func (c *client) closeConn() {
+	if c.conn != nil {
+		c.conn.Close()
+		c.conn = nil
+	}
+}
+
+// refresh reloads the items, and notifies the watchers if they changed.
+func (c *client) refresh(ctx context.Context) {
+	items, err := c.load(ctx)
+	switch {
+	case ctx.Err() != nil:
+	case err != nil:
+		c.Fail(err)
+	default:
+		c.Update(items...)
+	}
+}
+
+// poll reloads the items at the configured interval, until ctx is done.
+func (c *client) poll(ctx context.Context) {
+	defer c.closeConn()
+	ticker := time.NewTicker(c.cfg.PollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.refresh(ctx)
+		}
+	}
+}
+
+// follow subscribes to the keyspace notifications, until ctx is done.
+func (c *client) follow(ctx context.Context) {
+	defer c.closeConn()
+	for ctx.Err() == nil {
+		err := c.subscribe(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		c.Fail(err)
+		select {
+		case <-ctx.Done():
+		case <-time.After(c.cfg.RetryDelay):
+		}
+	}
+}
+
+// subscribe reloads the items after the keyspace notifications, coalescing those received within the debounce delay.
+// It only returns on failure.
+func (c *client) subscribe(ctx context.Context) error {
+	sub, err := dial(ctx, c.cfg)
+	if err != nil {
+		return err
+	}
+	defer sub.Close()
+	stop := context.AfterFunc(ctx, func() { sub.Close() })
+	defer stop()
+
+	pattern := "__keyspace@" + strconv.Itoa(c.cfg.DB) + "__:" + globEscape(c.key)
+	if c.cfg.Prefix {
+		pattern += "*"
+	}
+	if err := sub.send("PSUBSCRIBE", pattern); err != nil {
+		return err
+	}
+	if _, err := sub.read(); err != nil {
+		return err
+	}
+	// catch up with the changes made while not subscribed
+	c.refresh(ctx)
+
+	// the notifications are read in the background, and reported once per debounce delay
+	notified := make(chan struct{}, 1)
+	failed := make(chan error, 1)
+	go func() {
+		for {
+			reply, err := sub.read()
+			if err != nil {
+				failed <- err
+				return
+			}
+			if msg, ok := reply.([]any); ok && len(msg) == 4 && string(asBytes(msg[0])) == "pmessage" {
+				select {
+				case notified <- struct{}{}:
+				default:
+				}
+			}
+		}
+	}()
+
+	for {
+		select {
+		case err := <-failed:
+			return err
+		case <-notified:
+		}
+		timer := time.NewTimer(c.cfg.Debounce)
+		select {
+		case err := <-failed:
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+		// the notifications received meanwhile are covered by this reload
+		select {
+		case <-notified:
+		default:
+		}
+		c.refresh(ctx)
+	}
+}
+
+// load reads the hash fields, or the keys starting with the prefix, on the connection kept by the client.
+func (c *client) load(ctx context.Context) ([]configstore.Item, error) {
+	if c.conn == nil {
+		conn, err := dial(ctx, c.cfg)
+		if err != nil {
+			return nil, err
+		}
+		c.conn = conn
+	}
+	items, err := c.query(c.conn)
+	if err != nil {
+		// the connection may be broken, use a new one next time
+		c.closeConn()
+	}
+	return items, err
+}
+
+// query reads the hash fields, or the keys starting with the prefix.
+func (c *client) query(conn *conn) ([]configstore.Item, error) {
+	var items []configstore.Item
+	if !c.cfg.Prefix {
+		reply, err := conn.do("HGETALL", c.key)
+		if err != nil {
+			return nil, err
+		}
+		fields, err := replyStrings(reply)
+		if err != nil {
+			return nil, err
+		}
+		for i := 0; i+1 < len(fields); i += 2 {
+			if fields[i] != nil && fields[i+1] != nil {
+				items = append(items, configstore.NewItem(*fields[i], *fields[i+1], c.cfg.Priority))
+			}
+		}
+		return sortItems(items), nil
+	}
+
+	var keys []string
+	cursor := "0"
+	for {
+		reply, err := conn.do("SCAN", cursor, "MATCH", globEscape(c.key)+"*", "COUNT", "100")
+		if err != nil {
+			return nil, err
+		}
+		arr, ok := reply.([]any)
+		if !ok || len(arr) != 2 {
+			return nil, fmt.Errorf("redis: unexpected SCAN reply")
+		}
+		next, err := replyStrings(arr[:1])
+		if err != nil || next[0] == nil {
+			return nil, fmt.Errorf("redis: unexpected SCAN reply")
+		}
+		batch, err := replyStrings(arr[1])
+		if err != nil {
+			return nil, err
+		}
+		for _, k := range batch {
+			if k != nil {
+				keys = append(keys, *k)
+			}
+		}
+		if cursor = *next[0]; cursor == "0" {
+			break
+		}
+	}
+
+	for len(keys) > 0 {
+		n := min(len(keys), 100)
+		batch := keys[:n]
+		keys = keys[n:]
+		reply, err := conn.do(append([]string{"MGET"}, batch...)...)
+		if err != nil {
+			return nil, err
+		}
+		values, err := replyStrings(reply)
+		if err != nil {
+			return nil, err
+		}
+		for i, v := range values {
+			// a nil value is a key deleted since the scan, or holding another type than a string
+			if v != nil && i < len(batch) {
+				items = append(items, configstore.NewItem(strings.TrimPrefix(batch[i], c.key), *v, c.cfg.Priority))
+			}
+		}
+	}
+	return sortItems(items), nil
+}
+
+// sortItems sorts the items by key, since Redis returns them in no particular order.
+func sortItems(items []configstore.Item) []configstore.Item {
+	sort.Slice(items, func(i, j int) bool { return items[i].Key() < items[j].Key() })
+	return items
+}
+
+// globEscape escapes the special characters of the Redis glob-style patterns.
+func globEscape(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if strings.ContainsRune(`*?[]\`, r) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
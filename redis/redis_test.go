@@ -0,0 +1,350 @@
+package redis
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ovh/configstore"
+	"github.com/ovh/configstore/internal/storetest"
+)
+
+// fakeRedis is an in-process stand-in of a Redis server, implementing the commands used by the provider,
+// and publishing keyspace notifications.
+type fakeRedis struct {
+	ln       net.Listener
+	password string
+
+	mut         sync.Mutex
+	strings     map[string]string
+	hashes      map[string]map[string]string
+	subscribers map[net.Conn]string // pattern
+	commands    []string
+	conns       int
+}
+
+func newFakeRedis(t *testing.T, password string) *fakeRedis {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	f := &fakeRedis{
+		ln:          ln,
+		password:    password,
+		strings:     map[string]string{},
+		hashes:      map[string]map[string]string{},
+		subscribers: map[net.Conn]string{},
+	}
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			f.mut.Lock()
+			f.conns++
+			f.mut.Unlock()
+			go f.serve(c)
+		}
+	}()
+	t.Cleanup(func() { ln.Close() })
+	return f
+}
+
+func (f *fakeRedis) addr() string {
+	return f.ln.Addr().String()
+}
+
+func (f *fakeRedis) hset(key, field, value string) {
+	f.mut.Lock()
+	defer f.mut.Unlock()
+	if f.hashes[key] == nil {
+		f.hashes[key] = map[string]string{}
+	}
+	f.hashes[key][field] = value
+	f.notify(key, "hset")
+}
+
+func (f *fakeRedis) set(key, value string) {
+	f.mut.Lock()
+	defer f.mut.Unlock()
+	f.strings[key] = value
+	f.notify(key, "set")
+}
+
+func (f *fakeRedis) del(key string) {
+	f.mut.Lock()
+	defer f.mut.Unlock()
+	delete(f.strings, key)
+	delete(f.hashes, key)
+	f.notify(key, "del")
+}
+
+// disconnect closes the subscriber connections.
+func (f *fakeRedis) disconnect() {
+	f.mut.Lock()
+	defer f.mut.Unlock()
+	for c := range f.subscribers {
+		c.Close()
+		delete(f.subscribers, c)
+	}
+}
+
+func (f *fakeRedis) countCommands(name string) int {
+	f.mut.Lock()
+	defer f.mut.Unlock()
+	n := 0
+	for _, c := range f.commands {
+		if c == name {
+			n++
+		}
+	}
+	return n
+}
+
+// notify publishes a keyspace notification, must be called with mut held.
+func (f *fakeRedis) notify(key, event string) {
+	channel := "__keyspace@0__:" + key
+	for c, pattern := range f.subscribers {
+		if ok, _ := path.Match(pattern, channel); ok {
+			_, _ = io.WriteString(c, encode([]any{"pmessage", pattern, channel, event}))
+		}
+	}
+}
+
+func encode(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return "$-1\r\n"
+	case string:
+		return fmt.Sprintf("$%d\r\n%s\r\n", len(v), v)
+	case int:
+		return fmt.Sprintf(":%d\r\n", v)
+	case []any:
+		ret := fmt.Sprintf("*%d\r\n", len(v))
+		for _, e := range v {
+			ret += encode(e)
+		}
+		return ret
+	}
+	panic(fmt.Sprintf("cannot encode %T", v))
+}
+
+func (f *fakeRedis) serve(c net.Conn) {
+	defer c.Close()
+	r := bufio.NewReader(c)
+	authenticated := f.password == ""
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			return
+		}
+		cmd := strings.ToUpper(args[0])
+		f.mut.Lock()
+		f.commands = append(f.commands, cmd)
+		var reply string
+		switch {
+		case cmd == "AUTH":
+			if args[len(args)-1] == f.password {
+				authenticated = true
+				reply = "+OK\r\n"
+			} else {
+				reply = "-WRONGPASS invalid username-password pair\r\n"
+			}
+		case !authenticated:
+			reply = "-NOAUTH Authentication required.\r\n"
+		case cmd == "SELECT":
+			reply = "+OK\r\n"
+		case cmd == "HGETALL":
+			var fields []any
+			for k, v := range f.hashes[args[1]] {
+				fields = append(fields, k, v)
+			}
+			reply = encode(append([]any{}, fields...))
+		case cmd == "SCAN":
+			var keys []any
+			for k := range f.strings {
+				if ok, _ := path.Match(args[3], k); ok {
+					keys = append(keys, k)
+				}
+			}
+			reply = encode([]any{"0", append([]any{}, keys...)})
+		case cmd == "MGET":
+			var values []any
+			for _, k := range args[1:] {
+				if v, ok := f.strings[k]; ok {
+					values = append(values, v)
+				} else {
+					values = append(values, nil)
+				}
+			}
+			reply = encode(values)
+		case cmd == "PSUBSCRIBE":
+			f.subscribers[c] = args[1]
+			reply = encode([]any{"psubscribe", args[1], 1})
+		default:
+			reply = "-ERR unknown command\r\n"
+		}
+		_, err = io.WriteString(c, reply)
+		f.mut.Unlock()
+		if err != nil {
+			return
+		}
+	}
+}
+
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+	if err != nil || n < 1 {
+		return nil, fmt.Errorf("invalid command")
+	}
+	args := make([]string, n)
+	for i := range args {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		size, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+		if err != nil {
+			return nil, err
+		}
+		b := make([]byte, size+2)
+		if _, err := io.ReadFull(r, b); err != nil {
+			return nil, err
+		}
+		args[i] = string(b[:size])
+	}
+	return args, nil
+}
+
+func getValue(t *testing.T, s *configstore.Store, key string) string {
+	t.Helper()
+	v, err := s.GetItemValue(key)
+	require.NoError(t, err)
+	return v
+}
+
+func TestRedisHash(t *testing.T) {
+	fake := newFakeRedis(t, "secret")
+	fake.hset("myapp:config", "db_url", "postgres://db")
+	fake.hset("myapp:config", "port", "8080")
+
+	s := configstore.NewStore()
+	defer s.Close()
+	require.NoError(t, Register(s, "myapp:config", Config{Address: fake.addr(), Password: "secret", DB: 2, Priority: 3}))
+	assert.Equal(t, 1, fake.countCommands("SELECT"))
+
+	items, err := s.GetItemList()
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"db-url", "port"}, items.Keys())
+	i, err := items.GetItem("db-url")
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), i.Priority())
+	assert.Equal(t, "redis:myapp:config", i.Provider())
+
+	// a wrong password registers a failing provider
+	s = configstore.NewStore()
+	defer s.Close()
+	assert.Error(t, Register(s, "myapp:config", Config{Address: fake.addr(), Password: "nope"}))
+	_, err = s.GetItemList()
+	assert.Error(t, err)
+}
+
+func TestRedisPrefixWatch(t *testing.T) {
+	fake := newFakeRedis(t, "")
+	fake.set("myapp:foo", "bar")
+	fake.set("myapp:gone", "soon")
+	fake.set("other:key", "x")
+
+	s := configstore.NewStore()
+	defer s.Close()
+	ch := s.Watch()
+	require.NoError(t, Register(s, "myapp:", Config{Address: fake.addr(), Prefix: true, Watch: true, RetryDelay: 10 * time.Millisecond}))
+	storetest.WaitNotification(t, ch)
+	assert.Equal(t, "bar", getValue(t, s, "foo"))
+
+	// wait for the subscription
+	require.Eventually(t, func() bool { return fake.countCommands("PSUBSCRIBE") > 0 }, 5*time.Second, 5*time.Millisecond)
+
+	fake.set("myapp:foo", "baz")
+	storetest.WaitNotification(t, ch)
+	assert.Equal(t, "baz", getValue(t, s, "foo"))
+	fake.del("myapp:gone")
+	storetest.WaitNotification(t, ch)
+	_, err := s.GetItem("gone")
+	assert.ErrorIs(t, err, configstore.ErrNotFound)
+
+	// the changes made while disconnected are read when subscribing again
+	fake.disconnect()
+	fake.set("myapp:foo", "reconnected")
+	storetest.WaitNotification(t, ch)
+	assert.Equal(t, "reconnected", getValue(t, s, "foo"))
+}
+
+func TestRedisPoll(t *testing.T) {
+	fake := newFakeRedis(t, "")
+	fake.hset("myapp:config", "foo", "bar")
+
+	s := configstore.NewStore()
+	defer s.Close()
+	ch := s.Watch()
+	require.NoError(t, Register(s, "myapp:config", Config{Address: fake.addr(), PollInterval: 20 * time.Millisecond}))
+	storetest.WaitNotification(t, ch)
+
+	fake.hset("myapp:config", "foo", "baz")
+	storetest.WaitNotification(t, ch)
+	assert.Equal(t, "baz", getValue(t, s, "foo"))
+
+	// the connection is reused
+	require.Eventually(t, func() bool { return fake.countCommands("HGETALL") > 3 }, 5*time.Second, 5*time.Millisecond)
+	fake.mut.Lock()
+	assert.Equal(t, 1, fake.conns)
+	fake.mut.Unlock()
+}
+
+func TestRedisDebounce(t *testing.T) {
+	fake := newFakeRedis(t, "")
+	fake.hset("myapp:config", "foo", "bar")
+
+	s := configstore.NewStore()
+	defer s.Close()
+	ch := s.Watch()
+	require.NoError(t, Register(s, "myapp:config", Config{Address: fake.addr(), Watch: true, Debounce: 200 * time.Millisecond}))
+	storetest.WaitNotification(t, ch)
+	// the subscription is followed by a reload, catching up with the changes
+	require.Eventually(t, func() bool { return fake.countCommands("HGETALL") == 2 }, 5*time.Second, 5*time.Millisecond)
+
+	// a burst of notifications triggers a single reload
+	for i := 0; i < 10; i++ {
+		fake.hset("myapp:config", "foo", strconv.Itoa(i))
+	}
+	storetest.WaitNotification(t, ch)
+	assert.Equal(t, "9", getValue(t, s, "foo"))
+	assert.Equal(t, 3, fake.countCommands("HGETALL"))
+	fake.mut.Lock()
+	assert.Equal(t, 2, fake.conns, "one connection for the subscription, one for the reloads")
+	fake.mut.Unlock()
+}
+
+func TestReadBulkTooLong(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	go func() {
+		_, _ = io.WriteString(server, "$1099511627776\r\n")
+		server.Close()
+	}()
+	_, err := (&conn{c: client, r: bufio.NewReader(client)}).read()
+	assert.ErrorContains(t, err, "too long")
+}
@@ -0,0 +1,187 @@
+package redis
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxBulkLen is the maximum length of a bulk string reply, the maximum size of a Redis string.
+const maxBulkLen = 512 << 20
+
+// conn is a minimal client of the Redis protocol (RESP2), supporting the few commands used by the provider.
+type conn struct {
+	c       net.Conn
+	r       *bufio.Reader
+	timeout time.Duration
+}
+
+// redisError is an error reply.
+type redisError string
+
+func (e redisError) Error() string {
+	return "redis: " + string(e)
+}
+
+// dial connects to the server, authenticates and selects the database.
+func dial(ctx context.Context, cfg Config) (*conn, error) {
+	d := &net.Dialer{Timeout: cfg.Timeout}
+	var c net.Conn
+	var err error
+	if cfg.TLSConfig != nil {
+		c, err = (&tls.Dialer{NetDialer: d, Config: cfg.TLSConfig}).DialContext(ctx, "tcp", cfg.Address)
+	} else {
+		c, err = d.DialContext(ctx, "tcp", cfg.Address)
+	}
+	if err != nil {
+		return nil, err
+	}
+	rc := &conn{c: c, r: bufio.NewReader(c), timeout: cfg.Timeout}
+
+	password := cfg.Password
+	if cfg.PasswordFile != "" {
+		b, err := os.ReadFile(cfg.PasswordFile)
+		if err != nil {
+			c.Close()
+			return nil, err
+		}
+		password = strings.TrimSpace(string(b))
+	}
+	if password != "" {
+		args := []string{"AUTH", password}
+		if cfg.Username != "" {
+			args = []string{"AUTH", cfg.Username, password}
+		}
+		if _, err := rc.do(args...); err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+	if cfg.DB != 0 {
+		if _, err := rc.do("SELECT", strconv.Itoa(cfg.DB)); err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+	return rc, nil
+}
+
+func (c *conn) Close() error {
+	return c.c.Close()
+}
+
+// do sends a command, and reads its reply.
+func (c *conn) do(args ...string) (any, error) {
+	if c.timeout > 0 {
+		_ = c.c.SetDeadline(time.Now().Add(c.timeout))
+		defer c.c.SetDeadline(time.Time{})
+	}
+	if err := c.send(args...); err != nil {
+		return nil, err
+	}
+	return c.read()
+}
+
+// send writes a command, as an array of bulk strings.
+func (c *conn) send(args ...string) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, a := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(a), a)
+	}
+	_, err := io.WriteString(c.c, b.String())
+	return err
+}
+
+// read reads a reply: a string, an int64, a []byte (nil for a null bulk string) or a []any (nil for a null array).
+// Error replies are returned as a redisError.
+func (c *conn) read() (any, error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, errors.New("redis: invalid reply")
+	}
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, redisError(line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return []byte(nil), nil
+		}
+		if n > maxBulkLen {
+			return nil, fmt.Errorf("redis: bulk string too long (%d bytes)", n)
+		}
+		b := make([]byte, n+2)
+		if _, err := io.ReadFull(c.r, b); err != nil {
+			return nil, err
+		}
+		return b[:n], nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return []any(nil), nil
+		}
+		// the length is not trusted for the allocation, the elements are read one by one
+		ret := make([]any, 0, min(n, 1024))
+		for range n {
+			v, err := c.read()
+			if err != nil {
+				return nil, err
+			}
+			ret = append(ret, v)
+		}
+		return ret, nil
+	}
+	return nil, fmt.Errorf("redis: invalid reply type '%c'", line[0])
+}
+
+// asBytes returns the content of a bulk string reply, or nil.
+func asBytes(reply any) []byte {
+	b, _ := reply.([]byte)
+	return b
+}
+
+// replyStrings converts an array reply of bulk strings. Null elements are returned as nil.
+func replyStrings(reply any) ([]*string, error) {
+	arr, ok := reply.([]any)
+	if !ok {
+		return nil, fmt.Errorf("redis: unexpected reply %T", reply)
+	}
+	ret := make([]*string, len(arr))
+	for i, v := range arr {
+		switch v := v.(type) {
+		case []byte:
+			if v != nil {
+				s := string(v)
+				ret[i] = &s
+			}
+		case string:
+			ret[i] = &v
+		default:
+			return nil, fmt.Errorf("redis: unexpected reply element %T", v)
+		}
+	}
+	return ret, nil
+}
@@ -0,0 +1,81 @@
+package configstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+)
+
+// Reloadable is implemented by providers which are able to re-read their source on demand.
+// See Store.RegisterReloadableProvider and Store.Reload.
+type Reloadable interface {
+	// Items returns the current item list. This is the function that gets called by configstore.
+	Items() (ItemList, error)
+	// Reload re-reads the provider source. It should not notify the store watchers, the caller takes care of it.
+	Reload(ctx context.Context) error
+}
+
+// Reload re-reads the sources of all the reloadable providers, then notifies the watchers once.
+// The built-in file, filelist, filetree and env providers are reloadable, and a filelist registers the files added
+// to its directory since the last reload, and unregisters the removed ones.
+func (s *Store) Reload(ctx context.Context) error {
+	s.pMut.Lock()
+	var names []string
+	var entries []*providerEntry
+	for _, n := range s.orderedProviders() {
+		if p := s.providers[n]; p.reload != nil {
+			names = append(names, n)
+			entries = append(entries, p)
+		}
+	}
+	s.pMut.Unlock()
+
+	var errs []error
+	for i, e := range entries {
+		// a provider may be unregistered by a previous reload, e.g. the removed files of a filelist
+		s.pMut.Lock()
+		registered := s.providers[names[i]] == e
+		s.pMut.Unlock()
+		if !registered {
+			continue
+		}
+		if err := e.reload(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("configstore: reload provider '%s': %w", names[i], err))
+		}
+	}
+	s.NotifyWatchers()
+	return errors.Join(errs...)
+}
+
+// ReloadOnSignal calls Reload every time one of the given signals (SIGHUP if none) is received,
+// until the store is closed. Reload errors are logged.
+func (s *Store) ReloadOnSignal(sig ...os.Signal) {
+	if len(sig) == 0 {
+		sig = defaultReloadSignals
+	}
+	if len(sig) == 0 {
+		return
+	}
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, sig...)
+	s.reloadOn(ch, func() { signal.Stop(ch) })
+}
+
+// reloadOn calls Reload every time a value is received from ch, until the store is closed, then calls stop.
+func (s *Store) reloadOn(ch <-chan os.Signal, stop func()) {
+	go func() {
+		defer stop()
+		for {
+			select {
+			case <-s.ctx.Done():
+				return
+			case <-ch:
+				if err := s.Reload(s.ctx); err != nil {
+					logError(err)
+				}
+			}
+		}
+	}()
+}
@@ -0,0 +1,10 @@
+//go:build !js && !wasip1
+
+package configstore
+
+import (
+	"os"
+	"syscall"
+)
+
+var defaultReloadSignals = []os.Signal{syscall.SIGHUP}
@@ -0,0 +1,8 @@
+//go:build js || wasip1
+
+package configstore
+
+import "os"
+
+// SIGHUP is not available on this platform, ReloadOnSignal needs explicit signals.
+var defaultReloadSignals []os.Signal
@@ -0,0 +1,149 @@
+package configstore
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ovh/configstore/internal/storetest"
+)
+
+type reloadableTestProvider struct {
+	InMemoryProvider
+	reloads int
+}
+
+func (p *reloadableTestProvider) Reload(ctx context.Context) error {
+	p.reloads++
+	p.mut.Lock()
+	p.items = []Item{NewItem("reloads", "yes", 0)}
+	p.mut.Unlock()
+	return nil
+}
+
+func TestStoreReload(t *testing.T) {
+	dirname := t.TempDir()
+	filename := filepath.Join(dirname, "test.yaml")
+	require.NoError(t, os.WriteFile(filename, []byte("- key: foo\n  value: bar\n"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dirname, "tree"), []byte("tree value"), 0o600))
+	t.Setenv("RELOADTEST_BAZ", "baz")
+
+	s := NewStore()
+	defer s.Close()
+	s.File(filename)
+	s.FileTree(dirname)
+	s.Env("RELOADTEST")
+	custom := &reloadableTestProvider{}
+	s.RegisterReloadableProvider("custom", custom)
+	ch := s.Watch()
+
+	require.NoError(t, os.WriteFile(filename, []byte("- key: foo\n  value: buz\n"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dirname, "tree"), []byte("new tree value"), 0o600))
+	t.Setenv("RELOADTEST_BAZ", "new baz")
+
+	// nothing changes before the reload
+	v, err := s.GetItemValue("foo")
+	require.NoError(t, err)
+	assert.Equal(t, "bar", v)
+
+	require.NoError(t, s.Reload(context.Background()))
+	storetest.WaitNotification(t, ch)
+
+	v, err = s.GetItemValue("foo")
+	require.NoError(t, err)
+	assert.Equal(t, "buz", v)
+
+	v, err = s.GetItemValue("tree")
+	require.NoError(t, err)
+	assert.Equal(t, "new tree value", v)
+
+	v, err = s.GetItemValue("baz")
+	require.NoError(t, err)
+	assert.Equal(t, "new baz", v)
+
+	v, err = s.GetItemValue("reloads")
+	require.NoError(t, err)
+	assert.Equal(t, "yes", v)
+	assert.Equal(t, 1, custom.reloads)
+
+	require.NoError(t, os.Remove(filename))
+	assert.Error(t, s.Reload(context.Background()))
+}
+
+func TestStoreReloadOnSignal(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "test.yaml")
+	require.NoError(t, os.WriteFile(filename, []byte("- key: foo\n  value: bar\n"), 0o600))
+
+	s := NewStore()
+	defer s.Close()
+	s.File(filename)
+	// the signals are injected, instead of being sent to the whole test binary
+	signals := make(chan os.Signal, 1)
+	stopped := make(chan struct{})
+	s.reloadOn(signals, func() { close(stopped) })
+	ch := s.Watch()
+
+	require.NoError(t, os.WriteFile(filename, []byte("- key: foo\n  value: buz\n"), 0o600))
+	signals <- os.Interrupt
+	storetest.WaitNotification(t, ch)
+
+	v, err := s.GetItemValue("foo")
+	require.NoError(t, err)
+	assert.Equal(t, "buz", v)
+
+	s.Close()
+	storetest.WaitNotification(t, stopped)
+}
+
+func TestStoreReloadFileList(t *testing.T) {
+	dirname := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dirname, "a.yaml"), []byte("- key: a\n  value: a\n"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dirname, "b.yaml"), []byte("invalid: [\n"), 0o600))
+
+	s := NewStore()
+	defer s.Close()
+	assert.Error(t, fileList(s, dirname, providerOptions{}))
+	_, err := s.GetItemList()
+	assert.Error(t, err)
+
+	// the file which failed at startup is reloaded, and the new files are registered
+	require.NoError(t, os.WriteFile(filepath.Join(dirname, "b.yaml"), []byte("- key: b\n  value: b\n"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dirname, "c.yaml"), []byte("- key: c\n  value: c\n"), 0o600))
+	require.NoError(t, s.Reload(context.Background()))
+
+	items, err := s.GetItemList()
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"a", "b", "c"}, items.Keys())
+
+	// the items of a removed file are gone, and the reload does not fail on it
+	require.NoError(t, os.Remove(filepath.Join(dirname, "a.yaml")))
+	require.NoError(t, s.Reload(context.Background()))
+	items, err = s.GetItemList()
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"b", "c"}, items.Keys())
+	assert.NotContains(t, s.ProviderStatus(), "file:"+filepath.Join(dirname, "a.yaml"))
+	require.NoError(t, s.Reload(context.Background()))
+}
+
+func TestStoreReloadFileTree(t *testing.T) {
+	dirname := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dirname, "foo"), []byte("bar"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dirname, "foo"+FileTreeMetaSuffix), []byte("priority: [\n"), 0o600))
+
+	s := NewStore()
+	defer s.Close()
+	assert.Error(t, fileTree(s, dirname, providerOptions{}))
+	_, err := s.GetItemList()
+	assert.Error(t, err)
+
+	// the tree which failed at startup is reloaded
+	require.NoError(t, os.WriteFile(filepath.Join(dirname, "foo"+FileTreeMetaSuffix), []byte("priority: 20\n"), 0o600))
+	require.NoError(t, s.Reload(context.Background()))
+	i, err := s.GetItem("foo")
+	require.NoError(t, err)
+	assert.Equal(t, int64(20), i.Priority())
+}
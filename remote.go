@@ -0,0 +1,105 @@
+package configstore
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"sync"
+)
+
+// Remote keeps a local copy of the items read from a remote source (a database, a key/value store, an HTTP API...),
+// for the providers which read the source once, or follow its changes in the background.
+//
+// The provider is registered by Register, after the first read. If that read failed, a provider which is not
+// followed registers a failing provider. A followed provider fails until its items are set, and then keeps
+// serving its last items while the source fails.
+//
+// The provider reports its own status (see Store.ProviderStatus): Fail records the error of the source, Set clears
+// it, and a followed provider is reported as watching.
+type Remote struct {
+	s     *Store
+	name  string
+	inmem InMemoryProvider
+	state *providerTracker
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mut    sync.Mutex
+	loaded bool
+	err    error
+}
+
+// NewRemote returns the local copy of the items of the provider named name. See Remote.
+func (s *Store) NewRemote(name string) *Remote {
+	ctx, cancel := context.WithCancel(s.ctx)
+	return &Remote{s: s, name: name, state: &providerTracker{}, ctx: ctx, cancel: cancel}
+}
+
+// Context returns the context of the requests to the source, which is canceled when the store is closed,
+// or when Register is called for a provider which is not followed.
+func (r *Remote) Context() context.Context {
+	return r.ctx
+}
+
+// Register registers the provider, given the error of the first read. If follow is not set, the context is canceled,
+// and an error registers a failing provider. The error is returned. With the Optional option, an error wrapping
+// fs.ErrNotExist is ignored: the provider is empty until its items are set.
+func (r *Remote) Register(err error, follow bool, opts ...ProviderOption) error {
+	if err != nil && errors.Is(err, fs.ErrNotExist) && (providerOptions{}).apply(opts).optional {
+		r.Set()
+		err = nil
+	}
+	switch {
+	case err != nil && !follow:
+		r.cancel()
+		r.s.ErrorProvider(r.name, err)
+		return err
+	case err != nil:
+		r.Fail(err)
+	}
+	r.s.registerProvider(r.name, providerOptions{}.apply(opts).entry(r.s, &providerEntry{provider: r.Items, state: r.state, selfReported: true}))
+	if follow {
+		r.state.setWatching(true)
+	} else {
+		r.cancel()
+	}
+	return err
+}
+
+// Items returns the local copy of the items, or the last error if they were never set.
+func (r *Remote) Items() (ItemList, error) {
+	r.mut.Lock()
+	loaded, err := r.loaded, r.err
+	r.mut.Unlock()
+	if !loaded {
+		return ItemList{}, err
+	}
+	return r.inmem.Items()
+}
+
+// Set replaces the items, and reports whether they changed. The first call always reports a change.
+func (r *Remote) Set(items ...Item) bool {
+	r.state.record(len(items), nil)
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	changed := r.inmem.Set(items...) || !r.loaded
+	r.loaded, r.err = true, nil
+	return changed
+}
+
+// Update replaces the items, and notifies the watchers if they changed.
+func (r *Remote) Update(items ...Item) {
+	if r.Set(items...) {
+		r.s.NotifyWatchers()
+	}
+}
+
+// Fail logs and records the error of a read. Until the items are set, Items returns it.
+func (r *Remote) Fail(err error) {
+	logError(err)
+	r.state.record(0, err)
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	r.err = err
+}
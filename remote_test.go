@@ -0,0 +1,79 @@
+package configstore
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ovh/configstore/internal/storetest"
+)
+
+func TestRemote(t *testing.T) {
+	s := NewStore()
+	defer s.Close()
+	errDown := errors.New("source is down")
+
+	// a source which is not followed registers a failing provider
+	r := s.NewRemote("once")
+	assert.ErrorIs(t, r.Register(errDown, false), errDown)
+	assert.Error(t, r.Context().Err())
+	_, err := s.GetItemList()
+	assert.ErrorIs(t, err, errDown)
+
+	// a followed source fails until its items are set
+	s = NewStore()
+	defer s.Close()
+	ch := s.Watch()
+	r = s.NewRemote("followed")
+	assert.ErrorIs(t, r.Register(errDown, true), errDown)
+	require.NoError(t, r.Context().Err())
+	_, err = s.GetItemList()
+	assert.ErrorIs(t, err, errDown)
+	state := s.ProviderStatus()["followed"]
+	assert.ErrorIs(t, state.LastError, errDown)
+	assert.True(t, state.Watching)
+
+	r.Update(NewItem("foo", "bar", 0))
+	storetest.WaitNotification(t, ch)
+	v, err := s.GetItemValue("foo")
+	require.NoError(t, err)
+	assert.Equal(t, "bar", v)
+	state = s.ProviderStatus()["followed"]
+	assert.NoError(t, state.LastError)
+	assert.Equal(t, 1, state.ItemCount)
+
+	// the last items are served while the source fails, and the failure is reported
+	r.Fail(errDown)
+	v, err = s.GetItemValue("foo")
+	require.NoError(t, err)
+	assert.Equal(t, "bar", v)
+	state = s.ProviderStatus()["followed"]
+	assert.ErrorIs(t, state.LastError, errDown)
+	assert.Equal(t, 1, state.ItemCount)
+	assert.False(t, r.Set(NewItem("foo", "bar", 0)))
+	assert.NoError(t, s.ProviderStatus()["followed"].LastError)
+
+	s.Close()
+	assert.Error(t, r.Context().Err())
+}
+
+func TestRemoteOptional(t *testing.T) {
+	s := NewStore()
+	defer s.Close()
+
+	r := s.NewRemote("optional")
+	require.NoError(t, r.Register(fmt.Errorf("no such source: %w", fs.ErrNotExist), false, Optional()))
+	items, err := s.GetItemList()
+	require.NoError(t, err)
+	assert.Empty(t, items.Items)
+
+	// other errors are reported
+	r = s.NewRemote("failing")
+	assert.Error(t, r.Register(errors.New("source is down"), false, Optional()))
+	_, err = s.GetItemList()
+	assert.Error(t, err)
+}
@@ -0,0 +1,168 @@
+package configstore
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned (wrapped) by a resilient provider while its circuit is open, see ResilientProvider.
+var ErrCircuitOpen = errors.New("configstore: circuit open")
+
+// ErrDegraded is returned by a provider along with its last known good items, when its source fails.
+// GetItemList serves the items, and reports the provider as degraded in its status (see ProviderState.Degraded).
+type ErrDegraded struct {
+	// Err is the error of the source.
+	Err error
+}
+
+func (e ErrDegraded) Error() string {
+	return fmt.Sprintf("configstore: serving last known good items: %v", e.Err)
+}
+
+// Unwrap returns the error of the source.
+func (e ErrDegraded) Unwrap() error {
+	return e.Err
+}
+
+// RetryPolicy configures a resilient provider, see ResilientProvider. Zero fields get the default values.
+type RetryPolicy struct {
+	// Attempts is the number of calls made to the provider before giving up (3 by default).
+	Attempts int
+	// Backoff is the delay before the first retry, doubled after each attempt (100ms by default).
+	Backoff time.Duration
+	// MaxBackoff caps the delay between two attempts (5s by default).
+	MaxBackoff time.Duration
+	// CircuitThreshold is the number of consecutive failed calls which opens the circuit (5 by default).
+	CircuitThreshold int
+	// CircuitOpen is the delay during which the provider is not called once the circuit is open (30s by default).
+	// A single attempt is then made: the circuit closes if it succeeds, and opens again otherwise.
+	CircuitOpen time.Duration
+}
+
+func (r RetryPolicy) withDefaults() RetryPolicy {
+	if r.Attempts <= 0 {
+		r.Attempts = 3
+	}
+	if r.Backoff <= 0 {
+		r.Backoff = 100 * time.Millisecond
+	}
+	if r.MaxBackoff <= 0 {
+		r.MaxBackoff = 5 * time.Second
+	}
+	if r.CircuitThreshold <= 0 {
+		r.CircuitThreshold = 5
+	}
+	if r.CircuitOpen <= 0 {
+		r.CircuitOpen = 30 * time.Second
+	}
+	return r
+}
+
+// resilientProvider retries a failing provider, and falls back to its last known good items.
+type resilientProvider struct {
+	s      *Store
+	p      Provider
+	policy RetryPolicy
+
+	// now and after are time.Now and time.After, replaced by tests
+	now   func() time.Time
+	after func(time.Duration) <-chan time.Time
+
+	mut       sync.Mutex
+	last      ItemList
+	hasLast   bool
+	lastErr   error
+	failures  int
+	openUntil time.Time
+	trial     bool
+}
+
+func newResilientProvider(s *Store, p Provider, policy RetryPolicy) *resilientProvider {
+	return &resilientProvider{s: s, p: p, policy: policy.withDefaults(), now: time.Now, after: time.After}
+}
+
+// ResilientProvider wraps a provider backed by an unreliable source (remote API, network filesystem, ...).
+// Failing calls are retried with exponential backoff, and after CircuitThreshold consecutive failures the circuit opens:
+// the provider is left alone for a while. As long as the source fails, the last successfully returned items are served
+// along with an ErrDegraded error, so that GetItemList keeps working and reports the provider as degraded.
+// Without any previous success, errors are returned as is.
+//
+// The Retry option wraps a registered provider the same way, e.g. s.RegisterProvider(name, f, Retry(RetryPolicy{})).
+func (s *Store) ResilientProvider(p Provider, policy RetryPolicy) Provider {
+	return newResilientProvider(s, p, policy).Items
+}
+
+// Retry wraps the provider with retries, a circuit breaker and a last known good fallback, see Store.ResilientProvider.
+func Retry(policy RetryPolicy) ProviderOption {
+	return func(o *providerOptions) {
+		o.retry = &policy
+	}
+}
+
+// Items calls the provider, retrying on failure unless the circuit is open.
+// The lock is not held while calling the provider or waiting between attempts.
+func (r *resilientProvider) Items() (ItemList, error) {
+	r.mut.Lock()
+	attempts := r.policy.Attempts
+	trial := false
+	if r.failures >= r.policy.CircuitThreshold {
+		// once the circuit half-opens, a single caller makes the trial call, the others get the fallback
+		if r.trial || r.now().Before(r.openUntil) {
+			defer r.mut.Unlock()
+			return r.fallback(fmt.Errorf("%w: %v", ErrCircuitOpen, r.lastErr))
+		}
+		r.trial, trial, attempts = true, true, 1
+	}
+	r.mut.Unlock()
+
+	items, err := r.call(attempts)
+
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	if trial {
+		r.trial = false
+	}
+	if err == nil {
+		r.last, r.hasLast, r.lastErr, r.failures = items, true, nil, 0
+		return items, nil
+	}
+	r.lastErr = err
+	r.failures++
+	if r.failures >= r.policy.CircuitThreshold {
+		r.openUntil = r.now().Add(r.policy.CircuitOpen)
+		logError(fmt.Errorf("configstore: %d consecutive failures, opening circuit for %s: %w", r.failures, r.policy.CircuitOpen, err))
+	}
+	return r.fallback(err)
+}
+
+// call calls the provider up to the given number of attempts, with exponential backoff.
+func (r *resilientProvider) call(attempts int) (ItemList, error) {
+	backoff := r.policy.Backoff
+	var err error
+	for attempt := 0; attempt < attempts; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-r.s.ctx.Done():
+				return ItemList{}, err
+			case <-r.after(backoff):
+			}
+			backoff = min(2*backoff, r.policy.MaxBackoff)
+		}
+		var items ItemList
+		items, err = r.p()
+		if err == nil {
+			return items, nil
+		}
+	}
+	return ItemList{}, err
+}
+
+// fallback returns the last known good items if any, or the error. It must be called with mut held.
+func (r *resilientProvider) fallback(err error) (ItemList, error) {
+	if !r.hasLast {
+		return ItemList{}, err
+	}
+	return r.last, ErrDegraded{Err: err}
+}
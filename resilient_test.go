@@ -0,0 +1,181 @@
+package configstore
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeClock is a manual clock, whose timers fire at once and advance it.
+type fakeClock struct {
+	mut sync.Mutex
+	t   time.Time
+}
+
+func (c *fakeClock) now() time.Time {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	return c.t
+}
+
+func (c *fakeClock) advance(d time.Duration) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	c.t = c.t.Add(d)
+}
+
+func (c *fakeClock) after(d time.Duration) <-chan time.Time {
+	c.advance(d)
+	ch := make(chan time.Time, 1)
+	ch <- c.now()
+	return ch
+}
+
+func newFakeResilientProvider(s *Store, p Provider, policy RetryPolicy) (*resilientProvider, *fakeClock) {
+	clock := &fakeClock{t: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+	r := newResilientProvider(s, p, policy)
+	r.now, r.after = clock.now, clock.after
+	return r, clock
+}
+
+func TestResilientProvider(t *testing.T) {
+	s := NewStore()
+	defer s.Close()
+
+	errDown := errors.New("source is down")
+	var calls int32
+	var down atomic.Bool
+	r, clock := newFakeResilientProvider(s, func() (ItemList, error) {
+		atomic.AddInt32(&calls, 1)
+		if down.Load() {
+			return ItemList{}, errDown
+		}
+		return ItemList{Items: []Item{NewItem("foo", "bar", 0)}}, nil
+	}, RetryPolicy{Attempts: 3, Backoff: time.Second, CircuitThreshold: 2, CircuitOpen: time.Minute})
+	s.RegisterProvider("remote", r.Items)
+
+	v, err := s.GetItemValue("foo")
+	require.NoError(t, err)
+	assert.Equal(t, "bar", v)
+	assert.False(t, s.ProviderStatus()["remote"].Degraded)
+
+	// the last known good items are served while the source is down
+	down.Store(true)
+	atomic.StoreInt32(&calls, 0)
+	start := clock.now()
+	v, err = s.GetItemValue("foo")
+	require.NoError(t, err)
+	assert.Equal(t, "bar", v)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&calls))
+	assert.Equal(t, 3*time.Second, clock.now().Sub(start), "backoff 1s, then 2s")
+	status := s.ProviderStatus()["remote"]
+	assert.True(t, status.Degraded)
+	assert.ErrorIs(t, status.LastError, errDown)
+	assert.Equal(t, 1, status.ItemCount)
+
+	// the second failed call opens the circuit: the source is left alone
+	_, err = s.GetItemList()
+	require.NoError(t, err)
+	assert.Equal(t, int32(6), atomic.LoadInt32(&calls))
+	clock.advance(59 * time.Second)
+	_, err = s.GetItemList()
+	require.NoError(t, err)
+	assert.Equal(t, int32(6), atomic.LoadInt32(&calls))
+	assert.ErrorIs(t, s.ProviderStatus()["remote"].LastError, ErrCircuitOpen)
+
+	// a single trial call is made once the circuit half-opens
+	clock.advance(time.Second)
+	_, err = s.GetItemList()
+	require.NoError(t, err)
+	assert.Equal(t, int32(7), atomic.LoadInt32(&calls))
+
+	clock.advance(time.Minute)
+	down.Store(false)
+	_, err = s.GetItemList()
+	require.NoError(t, err)
+	status = s.ProviderStatus()["remote"]
+	assert.False(t, status.Degraded)
+	assert.NoError(t, status.LastError)
+}
+
+func TestResilientProviderTrial(t *testing.T) {
+	s := NewStore()
+	defer s.Close()
+
+	errDown := errors.New("source is down")
+	var calls int32
+	started, release := make(chan struct{}), make(chan struct{})
+	r, clock := newFakeResilientProvider(s, func() (ItemList, error) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			return ItemList{Items: []Item{NewItem("foo", "bar", 0)}}, nil
+		}
+		if atomic.LoadInt32(&calls) == 3 {
+			close(started)
+			<-release
+		}
+		return ItemList{}, errDown
+	}, RetryPolicy{Attempts: 1, CircuitThreshold: 1, CircuitOpen: time.Minute})
+
+	_, err := r.Items()
+	require.NoError(t, err)
+	_, err = r.Items()
+	assert.ErrorIs(t, err, errDown)
+
+	// while the trial call is in flight, the other callers are not blocked, and do not call the source
+	clock.advance(time.Minute)
+	done := make(chan error)
+	go func() {
+		_, err := r.Items()
+		done <- err
+	}()
+	<-started
+	items, err := r.Items()
+	assert.ErrorIs(t, err, ErrCircuitOpen)
+	assert.Len(t, items.Items, 1)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&calls))
+
+	close(release)
+	assert.ErrorIs(t, <-done, errDown)
+	_, err = r.Items()
+	assert.ErrorIs(t, err, ErrCircuitOpen)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&calls))
+}
+
+func TestResilientProviderWithoutLastKnownGood(t *testing.T) {
+	s := NewStore()
+	defer s.Close()
+
+	errDown := errors.New("source is down")
+	var calls int32
+	s.RegisterProvider("remote", s.ResilientProvider(func() (ItemList, error) {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			return ItemList{}, errDown
+		}
+		return ItemList{Items: []Item{NewItem("foo", "bar", 0)}}, nil
+	}, RetryPolicy{Attempts: 2, Backoff: time.Millisecond}))
+
+	_, err := s.GetItemList()
+	assert.ErrorIs(t, err, errDown)
+	assert.False(t, s.ProviderStatus()["remote"].Degraded)
+
+	v, err := s.GetItemValue("foo")
+	require.NoError(t, err)
+	assert.Equal(t, "bar", v)
+}
+
+func TestRetryFromEnvironment(t *testing.T) {
+	opts, spec, err := ProviderSpec{Name: "test", Options: map[string][]string{"retry": {"5"}, "retry-backoff": {"1s"}, "other": {"x"}}}.entryOptions()
+	require.NoError(t, err)
+	require.NotNil(t, opts.retry)
+	assert.Equal(t, RetryPolicy{Attempts: 5, Backoff: time.Second}, *opts.retry)
+	assert.Equal(t, []string{"x"}, spec.Options["other"])
+	assert.Len(t, spec.Options, 1)
+
+	_, _, err = ProviderSpec{Options: map[string][]string{"retry": {"many"}}}.entryOptions()
+	assert.Error(t, err)
+}
@@ -0,0 +1,335 @@
+// Package s3 provides a configstore provider reading documents from an S3-compatible bucket.
+//
+// The location is either a single object ("<bucket>/<key>"), or a prefix ending with a slash ("<bucket>/<prefix>/"),
+// in which case every object directly under the prefix is read, like the filelist provider does for a directory.
+// The documents use the same format as files, unless another decoder is selected (see configstore.RegisterDecoder).
+// The requests are signed with AWS Signature Version 4, and use path-style URLs (<endpoint>/<bucket>/<key>).
+//
+// Importing the package registers the "s3" provider factory:
+//
+//	CONFIGURATION_FROM=s3:mybucket/myapp/?refresh=true&interval=1m&endpoint=https://s3.gra.io.cloud.ovh.net&region=gra
+//
+// The refreshing variants poll the objects, and only download those whose ETag changed: a single object
+// is checked with a HEAD request, a prefix with a listing. The watchers get notified when the items change.
+package s3
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ovh/configstore"
+)
+
+func init() {
+	options := []string{"endpoint", "region", "format"}
+	for _, variant := range []struct {
+		suffix, description string
+		options             []string
+	}{
+		{"", "Reads documents from an S3-compatible bucket.", options},
+		{"+refresh", "Reads documents from an S3-compatible bucket, and polls them for changes with their ETag.", append([]string{"interval"}, options...)},
+		{"+poll", "Same as s3+refresh.", append([]string{"interval"}, options...)},
+	} {
+		name := "s3" + variant.suffix
+		configstore.RegisterProviderFactoryInfo(configstore.ProviderFactoryInfo{
+			Name:        name,
+			Description: variant.description,
+			Syntax:      name + ":<bucket>/<key or prefix/>",
+			Examples:    []string{name + ":mybucket/myapp/config.yaml", name + ":mybucket/myapp/?region=gra"},
+			Options:     variant.options,
+			Factory:     factory(variant.suffix),
+		})
+	}
+}
+
+// DefaultRegion is the region used when none is configured.
+const DefaultRegion = "us-east-1"
+
+// Config configures the s3 provider, see Register.
+type Config struct {
+	// Endpoint is the URL of the S3 service (AWS_ENDPOINT_URL_S3, or AWS_ENDPOINT_URL, or the AWS endpoint of the region).
+	Endpoint string
+	// Region is the region of the bucket (AWS_REGION, or AWS_DEFAULT_REGION, or DefaultRegion).
+	Region string
+	// AccessKeyID, SecretAccessKey and SessionToken are the credentials
+	// (AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN by default).
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	// HTTPClient is the client used for the requests. By default, its timeout is configstore.DefaultHTTPTimeout.
+	HTTPClient *http.Client
+	// Format is the name of the decoder used to read the documents. By default, it is detected from the object
+	// content type, then from the key extension.
+	Format string
+	// PollInterval, if set, polls the objects at that interval.
+	PollInterval time.Duration
+}
+
+func factory(variant string) configstore.ProviderFactoryFunc {
+	return func(s *configstore.Store, spec configstore.ProviderSpec) error {
+		cfg := Config{
+			Endpoint: spec.Option("endpoint"),
+			Region:   spec.Option("region"),
+			Format:   spec.Option("format"),
+		}
+		var err error
+		if variant != "" {
+			cfg.PollInterval, err = spec.DurationOption("interval", configstore.DefaultPollInterval)
+		}
+		if err != nil {
+			s.ErrorProvider("s3:"+spec.Arg, err)
+			return err
+		}
+		return Register(s, spec.Arg, cfg, spec.ProviderOptions()...)
+	}
+}
+
+// object is a document read from the bucket.
+type object struct {
+	etag  string
+	items []configstore.Item
+}
+
+// client keeps a local copy of the items read from the bucket.
+type client struct {
+	*configstore.Remote
+	bucket string
+	key    string // a prefix if it is empty or ends with a slash
+	cfg    Config
+	creds  credentials
+
+	// only used by the goroutine loading the objects
+	objects map[string]object
+}
+
+// Register registers a provider reading the documents at location ("<bucket>/<key>" or "<bucket>/<prefix>/"),
+// named "s3:<location>". If cfg.PollInterval is set, the objects are polled until the store is closed,
+// and the watchers get notified when the items change (see configstore.Remote for the handling of failures).
+func Register(s *configstore.Store, location string, cfg Config, opts ...configstore.ProviderOption) error {
+	if cfg.Region == "" {
+		cfg.Region = firstEnv("AWS_REGION", "AWS_DEFAULT_REGION")
+	}
+	if cfg.Region == "" {
+		cfg.Region = DefaultRegion
+	}
+	if cfg.Endpoint == "" {
+		cfg.Endpoint = firstEnv("AWS_ENDPOINT_URL_S3", "AWS_ENDPOINT_URL")
+	}
+	if cfg.Endpoint == "" {
+		cfg.Endpoint = "https://s3." + cfg.Region + ".amazonaws.com"
+	}
+	cfg.Endpoint = strings.TrimSuffix(cfg.Endpoint, "/")
+	if cfg.AccessKeyID == "" && cfg.SecretAccessKey == "" {
+		cfg.AccessKeyID = os.Getenv("AWS_ACCESS_KEY_ID")
+		cfg.SecretAccessKey = os.Getenv("AWS_SECRET_ACCESS_KEY")
+		cfg.SessionToken = os.Getenv("AWS_SESSION_TOKEN")
+	}
+	if cfg.HTTPClient == nil {
+		cfg.HTTPClient = &http.Client{Timeout: configstore.DefaultHTTPTimeout}
+	}
+	name := "s3:" + location
+
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(location, "/"), "/")
+	if bucket == "" {
+		err := fmt.Errorf("s3: %s: expected <bucket>/<key or prefix/>", location)
+		s.ErrorProvider(name, err)
+		return err
+	}
+	c := &client{
+		Remote:  s.NewRemote(name),
+		bucket:  bucket,
+		key:     key,
+		cfg:     cfg,
+		creds:   credentials{cfg.AccessKeyID, cfg.SecretAccessKey, cfg.SessionToken},
+		objects: map[string]object{},
+	}
+
+	items, err := c.load(c.Context())
+	if err == nil {
+		c.Set(items...)
+	}
+	err = c.Register(err, cfg.PollInterval > 0, opts...)
+	if cfg.PollInterval > 0 {
+		go c.poll(c.Context())
+	}
+	return err
+}
+
+// poll reloads the objects at the configured interval, until ctx is done.
+func (c *client) poll(ctx context.Context) {
+	ticker := time.NewTicker(c.cfg.PollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			items, err := c.load(ctx)
+			switch {
+			case ctx.Err() != nil:
+				return
+			case err != nil:
+				c.Fail(err)
+			default:
+				c.Update(items...)
+			}
+		}
+	}
+}
+
+// load reads the objects whose ETag changed, and returns the items of all the objects.
+func (c *client) load(ctx context.Context) ([]configstore.Item, error) {
+	var etags map[string]string
+	var err error
+	if c.key == "" || strings.HasSuffix(c.key, "/") {
+		etags, err = c.list(ctx)
+	} else {
+		var etag string
+		etag, err = c.head(ctx, c.key)
+		etags = map[string]string{c.key: etag}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	objects := make(map[string]object, len(etags))
+	for key, etag := range etags {
+		if prev, ok := c.objects[key]; ok && etag != "" && prev.etag == etag {
+			objects[key] = prev
+			continue
+		}
+		obj, err := c.get(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		objects[key] = obj
+	}
+	c.objects = objects
+
+	keys := make([]string, 0, len(objects))
+	for k := range objects {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var items []configstore.Item
+	for _, k := range keys {
+		items = append(items, objects[k].items...)
+	}
+
+	return items, nil
+}
+
+// listBucketResult is the response of ListObjectsV2.
+type listBucketResult struct {
+	IsTruncated           bool
+	NextContinuationToken string
+	Contents              []struct {
+		Key  string
+		ETag string
+	}
+}
+
+// list returns the ETags of the objects directly under the prefix.
+func (c *client) list(ctx context.Context) (map[string]string, error) {
+	ret := map[string]string{}
+	token := ""
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {c.key}, "delimiter": {"/"}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		resp, err := c.do(ctx, http.MethodGet, "", query)
+		if err != nil {
+			return nil, err
+		}
+		var result listBucketResult
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("s3: %s: list: %w", c.bucket, err)
+		}
+		for _, obj := range result.Contents {
+			if !strings.HasSuffix(obj.Key, "/") {
+				ret[obj.Key] = obj.ETag
+			}
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return ret, nil
+		}
+		token = result.NextContinuationToken
+	}
+}
+
+// head returns the ETag of an object.
+func (c *client) head(ctx context.Context, key string) (string, error) {
+	resp, err := c.do(ctx, http.MethodHead, key, nil)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+	return resp.Header.Get("ETag"), nil
+}
+
+// get downloads and decodes an object.
+func (c *client) get(ctx context.Context, key string) (object, error) {
+	resp, err := c.do(ctx, http.MethodGet, key, nil)
+	if err != nil {
+		return object{}, err
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return object{}, err
+	}
+	items, err := configstore.Decode(c.cfg.Format, resp.Header.Get("Content-Type"), key, b)
+	if err != nil {
+		return object{}, fmt.Errorf("s3: %s/%s: %w", c.bucket, key, err)
+	}
+	return object{etag: resp.Header.Get("ETag"), items: items}, nil
+}
+
+// do sends a signed request about the bucket (empty key) or one of its objects.
+func (c *client) do(ctx context.Context, method, key string, query url.Values) (*http.Response, error) {
+	u := c.cfg.Endpoint + uriEncode("/"+c.bucket+"/"+key, false)
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	if c.creds.accessKeyID != "" {
+		sign(req, c.creds, c.cfg.Region, time.Now())
+	}
+	resp, err := c.cfg.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return resp, nil
+	case http.StatusNotFound:
+		resp.Body.Close()
+		return nil, fmt.Errorf("s3: %s/%s: %w", c.bucket, key, fs.ErrNotExist)
+	}
+	resp.Body.Close()
+	return nil, fmt.Errorf("s3: %s/%s: unexpected status: %s", c.bucket, key, resp.Status)
+}
+
+func firstEnv(names ...string) string {
+	for _, n := range names {
+		if v := os.Getenv(n); v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,278 @@
+package configstore
+
+import (
+	"fmt"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ProviderSpec describes a provider to instantiate, as read from the ConfigEnvVar environment variable.
+//
+// The variable holds a comma-separated list of entries, following a URL-like grammar:
+//
+//	name[:arg][?option=value&option=value...]
+//
+// e.g. file:/etc/myapp/config.yaml?refresh=true&debounce=1s
+//
+// Options use the URL query syntax (values can be percent-encoded). The characters ',', '?' and '"' can be escaped
+// with a backslash, and any part of an entry can be double-quoted to be taken literally:
+//
+//	file:"/etc/my,app/config.yaml"?refresh=true
+//
+// The "refresh" option is handled for all factories: refresh=true selects the "<name>+refresh" factory,
+// refresh=poll selects the "<name>+poll" factory.
+//
+// The factories registered with the deprecated RegisterProviderFactory keep the historical syntax: their argument is
+// the text following the colon up to the next comma, as is.
+type ProviderSpec struct {
+	// Name is the name of the provider factory, e.g. "file+refresh".
+	Name string
+	// Arg is the argument given to the provider factory, e.g. "/etc/myapp/config.yaml".
+	Arg string
+	// Options holds the options given after the argument.
+	Options url.Values
+
+	// entry holds the options handled for all factories, see ProviderOptions.
+	entry providerOptions
+	// entryUsed is set once the factory read the entry options.
+	entryUsed *bool
+}
+
+// String returns the spec in the ConfigEnvVar syntax.
+func (p ProviderSpec) String() string {
+	ret := p.Name
+	if p.Arg != "" {
+		ret += ":" + p.Arg
+	}
+	if len(p.Options) > 0 {
+		ret += "?" + p.Options.Encode()
+	}
+	return ret
+}
+
+// Option returns the value of an option, or an empty string if it is not set.
+func (p ProviderSpec) Option(name string) string {
+	return p.Options.Get(name)
+}
+
+// ProviderOptions returns the options handled for all factories (priority, layer, rank, cache and retry).
+// Factories pass them to the registration of their providers, e.g. s.RegisterProvider(name, f, spec.ProviderOptions()...).
+// InitFromEnvironment fails when such options are set, but the factory does not read them.
+func (p ProviderSpec) ProviderOptions() []ProviderOption {
+	if p.entryUsed != nil {
+		*p.entryUsed = true
+	}
+	if !p.entry.hasEntrySettings() {
+		return nil
+	}
+	entry := p.entry
+	return []ProviderOption{func(o *providerOptions) {
+		o.priority, o.rank, o.cache, o.retry = entry.priority, entry.rank, entry.cache, entry.retry
+	}}
+}
+
+// DurationOption returns the value of an option as a duration, or def if it is not set.
+func (p ProviderSpec) DurationOption(name string, def time.Duration) (time.Duration, error) {
+	v := p.Options.Get(name)
+	if v == "" {
+		return def, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return def, fmt.Errorf("option '%s': invalid duration '%s'", name, v)
+	}
+	return d, nil
+}
+
+// BoolOption returns the value of an option as a boolean, or def if it is not set.
+func (p ProviderSpec) BoolOption(name string, def bool) (bool, error) {
+	v := p.Options.Get(name)
+	if v == "" {
+		return def, nil
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return def, fmt.Errorf("option '%s': invalid boolean '%s'", name, v)
+	}
+	return b, nil
+}
+
+// IntOption returns the value of an option as an integer, or def if it is not set.
+func (p ProviderSpec) IntOption(name string, def int64) (int64, error) {
+	v := p.Options.Get(name)
+	if v == "" {
+		return def, nil
+	}
+	i, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return def, fmt.Errorf("option '%s': invalid integer '%s'", name, v)
+	}
+	return i, nil
+}
+
+// checkOptions returns an error if the spec holds options which are not part of the supported list.
+func (p ProviderSpec) checkOptions(supported []string) error {
+	for k := range p.Options {
+		if !slices.Contains(supported, k) {
+			return fmt.Errorf("unknown option '%s'", k)
+		}
+	}
+	return nil
+}
+
+// resolveRefresh applies the "refresh" option, by selecting the matching factory variant.
+func (p ProviderSpec) resolveRefresh() (ProviderSpec, error) {
+	v, ok := p.Options["refresh"]
+	if !ok {
+		return p, nil
+	}
+	options := url.Values{}
+	for k, val := range p.Options {
+		if k != "refresh" {
+			options[k] = val
+		}
+	}
+	p.Options = options
+
+	var suffix string
+	switch strings.ToLower(v[0]) {
+	case "true", "notify":
+		suffix = "+refresh"
+	case "poll":
+		suffix = "+poll"
+	case "false":
+		return p, nil
+	default:
+		return p, fmt.Errorf("option 'refresh': invalid value '%s'", v[0])
+	}
+	if strings.Contains(p.Name, "+") {
+		return p, fmt.Errorf("option 'refresh' cannot be used with provider '%s'", p.Name)
+	}
+	p.Name += suffix
+	return p, nil
+}
+
+var entryOptionNames = []string{"rank", "cache", "retry", "retry-backoff"}
+
+// entryOptions extracts the options handled for all factories:
+// the priority options (see priorityRule), rank=<n>, cache=<ttl>, retry=<attempts> and retry-backoff=<delay>.
+func (p ProviderSpec) entryOptions() (providerOptions, ProviderSpec, error) {
+	var opts providerOptions
+	var err error
+	opts.priority, p, err = p.priorityRule()
+	if err != nil {
+		return opts, p, err
+	}
+	if _, ok := p.Options["rank"]; ok {
+		rank, err := p.IntOption("rank", 0)
+		if err != nil {
+			return opts, p, err
+		}
+		opts.rank = new(int)
+		*opts.rank = int(rank)
+	}
+	opts.cache, err = p.DurationOption("cache", 0)
+	if err != nil {
+		return opts, p, err
+	}
+	if p.Option("retry") != "" || p.Option("retry-backoff") != "" {
+		attempts, err := p.IntOption("retry", 0)
+		if err != nil {
+			return opts, p, err
+		}
+		backoff, err := p.DurationOption("retry-backoff", 0)
+		if err != nil {
+			return opts, p, err
+		}
+		opts.retry = &RetryPolicy{Attempts: int(attempts), Backoff: backoff}
+	}
+
+	options := url.Values{}
+	for k, v := range p.Options {
+		if !slices.Contains(entryOptionNames, k) {
+			options[k] = v
+		}
+	}
+	p.Options = options
+	return opts, p, nil
+}
+
+// specEscapable lists the characters which can be escaped with a backslash.
+// Other backslashes are kept as is, so that Windows paths do not need escaping.
+const specEscapable = `,?"`
+
+// parseProviderSpecs parses the content of the ConfigEnvVar environment variable.
+// The legacy syntax (name:arg, split on the first colon) is a subset of the current one.
+func parseProviderSpecs(cfg string) ([]ProviderSpec, error) {
+	const (
+		partName = iota
+		partArg
+		partOptions
+	)
+
+	var specs []ProviderSpec
+	var parts [3]strings.Builder
+	part := partName
+	quoted := false
+
+	flush := func() error {
+		name := strings.TrimSpace(parts[partName].String())
+		arg := strings.TrimSpace(parts[partArg].String())
+		rawOptions := strings.TrimSpace(parts[partOptions].String())
+		for i := range parts {
+			parts[i].Reset()
+		}
+		part = partName
+
+		if name == "" && arg == "" && rawOptions == "" {
+			return nil
+		}
+		options, err := url.ParseQuery(rawOptions)
+		if err != nil {
+			return fmt.Errorf("%s:%s: invalid options: %w", name, arg, err)
+		}
+		specs = append(specs, ProviderSpec{Name: name, Arg: arg, Options: options})
+		return nil
+	}
+
+	for i := 0; i < len(cfg); i++ {
+		c := cfg[i]
+		switch {
+		case c == '\\' && i+1 < len(cfg) && strings.IndexByte(specEscapable, cfg[i+1]) >= 0:
+			i++
+			parts[part].WriteByte(cfg[i])
+		case c == '"':
+			quoted = !quoted
+		case quoted:
+			parts[part].WriteByte(c)
+		case c == ',':
+			if err := flush(); err != nil {
+				return nil, err
+			}
+		case c == ':' && part == partName:
+			part = partArg
+			if info, ok := getProviderFactory(strings.TrimSpace(parts[partName].String())); ok && info.legacy {
+				end := strings.IndexByte(cfg[i+1:], ',')
+				if end < 0 {
+					end = len(cfg) - i - 1
+				}
+				parts[partArg].WriteString(cfg[i+1 : i+1+end])
+				i += end
+			}
+		case c == '?' && part != partOptions:
+			part = partOptions
+		default:
+			parts[part].WriteByte(c)
+		}
+	}
+	if quoted {
+		return nil, fmt.Errorf("unterminated quote in '%s'", cfg)
+	}
+	if err := flush(); err != nil {
+		return nil, err
+	}
+	return specs, nil
+}
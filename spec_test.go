@@ -0,0 +1,153 @@
+package configstore
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseProviderSpecs(t *testing.T) {
+	tests := []struct {
+		cfg      string
+		expected []ProviderSpec
+	}{
+		{
+			cfg: "file:/etc/myfile.conf, filelist:/home/foobar/configs,env",
+			expected: []ProviderSpec{
+				{Name: "file", Arg: "/etc/myfile.conf", Options: url.Values{}},
+				{Name: "filelist", Arg: "/home/foobar/configs", Options: url.Values{}},
+				{Name: "env", Options: url.Values{}},
+			},
+		},
+		{
+			cfg: "file:/etc/a.yaml?priority=20&refresh=true&optional=true",
+			expected: []ProviderSpec{
+				{Name: "file", Arg: "/etc/a.yaml", Options: url.Values{"priority": {"20"}, "refresh": {"true"}, "optional": {"true"}}},
+			},
+		},
+		{
+			cfg: `file:"/etc/my,app/a.yaml?"?refresh=true,filetree:/etc/my\,secrets\?,file:C:\configs\app.yaml`,
+			expected: []ProviderSpec{
+				{Name: "file", Arg: "/etc/my,app/a.yaml?", Options: url.Values{"refresh": {"true"}}},
+				{Name: "filetree", Arg: "/etc/my,secrets?", Options: url.Values{}},
+				{Name: "file", Arg: `C:\configs\app.yaml`, Options: url.Values{}},
+			},
+		},
+		{
+			cfg: "http:https://example.com/app.yaml?interval=30s&token=a%2Cb,,",
+			expected: []ProviderSpec{
+				{Name: "http", Arg: "https://example.com/app.yaml", Options: url.Values{"interval": {"30s"}, "token": {"a,b"}}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		specs, err := parseProviderSpecs(tt.cfg)
+		require.NoError(t, err, tt.cfg)
+		assert.Equal(t, tt.expected, specs, tt.cfg)
+	}
+
+	_, err := parseProviderSpecs(`file:"/etc/a.yaml`)
+	assert.Error(t, err)
+
+	_, err = parseProviderSpecs(`file:/etc/a.yaml?a=%zz`)
+	assert.Error(t, err)
+}
+
+func TestProviderSpecResolveRefresh(t *testing.T) {
+	spec, err := ProviderSpec{Name: "file", Options: url.Values{"refresh": {"true"}, "debounce": {"1s"}}}.resolveRefresh()
+	require.NoError(t, err)
+	assert.Equal(t, "file+refresh", spec.Name)
+	assert.Equal(t, url.Values{"debounce": {"1s"}}, spec.Options)
+
+	spec, err = ProviderSpec{Name: "file", Options: url.Values{"refresh": {"poll"}}}.resolveRefresh()
+	require.NoError(t, err)
+	assert.Equal(t, "file+poll", spec.Name)
+
+	spec, err = ProviderSpec{Name: "file", Options: url.Values{"refresh": {"false"}}}.resolveRefresh()
+	require.NoError(t, err)
+	assert.Equal(t, "file", spec.Name)
+
+	_, err = ProviderSpec{Name: "file+refresh", Options: url.Values{"refresh": {"poll"}}}.resolveRefresh()
+	assert.Error(t, err)
+
+	_, err = ProviderSpec{Name: "file", Options: url.Values{"refresh": {"sometimes"}}}.resolveRefresh()
+	assert.Error(t, err)
+}
+
+func TestProviderSpecOptions(t *testing.T) {
+	spec := ProviderSpec{Options: url.Values{"d": {"3s"}, "b": {"true"}, "i": {"-4"}, "bad": {"x"}}}
+
+	d, err := spec.DurationOption("d", 0)
+	require.NoError(t, err)
+	assert.Equal(t, 3*time.Second, d)
+	d, err = spec.DurationOption("unset", time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, time.Minute, d)
+	_, err = spec.DurationOption("bad", 0)
+	assert.Error(t, err)
+
+	b, err := spec.BoolOption("b", false)
+	require.NoError(t, err)
+	assert.True(t, b)
+	_, err = spec.BoolOption("bad", false)
+	assert.Error(t, err)
+
+	i, err := spec.IntOption("i", 0)
+	require.NoError(t, err)
+	assert.Equal(t, int64(-4), i)
+	_, err = spec.IntOption("bad", 0)
+	assert.Error(t, err)
+
+	assert.Equal(t, "file:/a?refresh=true", ProviderSpec{Name: "file", Arg: "/a", Options: url.Values{"refresh": {"true"}}}.String())
+}
+
+func TestInitFromEnvironmentOptions(t *testing.T) {
+	t.Setenv(ConfigEnvVar, "file:tests/fixtures/fileprovider/test.yaml?refresh=poll&interval=1h")
+	s := NewStore()
+	defer s.Close()
+	require.NoError(t, s.InitFromEnvironment())
+	status := s.ProviderStatus()["file+poll:tests/fixtures/fileprovider/test.yaml"]
+	assert.True(t, status.Watching)
+
+	t.Setenv(ConfigEnvVar, "file:tests/fixtures/fileprovider/test.yaml?intervall=1h")
+	err := NewStore().InitFromEnvironment()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "unknown option 'intervall'")
+}
+
+func TestProviderSpecEntryOptions(t *testing.T) {
+	spec := ProviderSpec{Name: "file", Arg: "/a", Options: url.Values{"rank": {"-2"}, "layer": {"env"}, "optional": {"true"}}}
+	opts, spec, err := spec.entryOptions()
+	require.NoError(t, err)
+	require.NotNil(t, opts.rank)
+	assert.Equal(t, -2, *opts.rank)
+	assert.Equal(t, LayerEnv, opts.priority.layer)
+	assert.Equal(t, url.Values{"optional": {"true"}}, spec.Options)
+
+	_, _, err = ProviderSpec{Options: url.Values{"rank": {"first"}}}.entryOptions()
+	assert.Error(t, err)
+
+	t.Setenv(ConfigEnvVar, "file:tests/fixtures/fileprovider/test.yaml?rank=1")
+	s := NewStore()
+	defer s.Close()
+	require.NoError(t, s.InitFromEnvironment())
+	s.InMemory("test").Add(NewItem("my-config-key-1", "inmem", 0))
+	assert.Equal(t, "inmem", mustValue(Filter().Slice("my-config-key-1").Store(s).MustGetFirstItem()))
+}
+
+func TestLegacyProviderFactory(t *testing.T) {
+	var args []string
+	RegisterProviderFactory("legacyspec", func(s *Store, arg string) {
+		args = append(args, arg)
+	})
+	t.Setenv(ConfigEnvVar, `legacyspec:https://api.example.com/cfg?token=abc&q="a b,legacyspec: \x ,env`)
+
+	s := NewStore()
+	defer s.Close()
+	require.NoError(t, s.InitFromEnvironment())
+	assert.Equal(t, []string{`https://api.example.com/cfg?token=abc&q="a b`, `\x`}, args)
+}
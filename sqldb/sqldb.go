@@ -0,0 +1,308 @@
+// Package sqldb provides a configstore provider reading items from a SQL database, through any database/sql driver.
+//
+// The query returns one row per item, with the key, value and priority columns (the priority column is optional,
+// and a NULL priority defaults to Config.Priority). Rows with a NULL key or value are skipped.
+//
+// Importing the package registers the "sql" provider factory, for the drivers registered in the program:
+//
+//	CONFIGURATION_FROM=sql:postgres?dsn-env=MYAPP_DSN&name=tenant&refresh=true&interval=1m&change-query=SELECT+MAX(updated_at)+FROM+config
+//
+// The provider is named "sql:<driver>:<name>", the name option defaulting to the query.
+//
+// The refreshing variant polls the database at the given interval. If a change query is set, it is run first,
+// and the items are only read again when its result changed: it usually selects the maximum of a modification
+// column, e.g. "SELECT COUNT(*), MAX(updated_at) FROM config", so that deletions are detected as well.
+// The watchers get notified when the items change.
+package sqldb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ovh/configstore"
+)
+
+func init() {
+	options := []string{"dsn-env", "dsn-file", "name", "query", "timeout"}
+	for _, variant := range []struct {
+		suffix, description string
+		options             []string
+	}{
+		{"", "Reads items from a SQL query.", options},
+		{"+refresh", "Reads items from a SQL query, and polls it for changes.", append([]string{"interval", "change-query"}, options...)},
+		{"+poll", "Same as sql+refresh.", append([]string{"interval", "change-query"}, options...)},
+	} {
+		name := "sql" + variant.suffix
+		configstore.RegisterProviderFactoryInfo(configstore.ProviderFactoryInfo{
+			Name:        name,
+			Description: variant.description,
+			Syntax:      name + ":<driver>",
+			Examples:    []string{name + ":postgres?dsn-env=MYAPP_DSN&name=myapp"},
+			Options:     variant.options,
+			Factory:     factory(variant.suffix),
+		})
+	}
+}
+
+const (
+	// DefaultQuery is the query reading the items, when none is specified.
+	DefaultQuery = "SELECT name, value, priority FROM configstore"
+	// DefaultTimeout is the default timeout of the queries.
+	DefaultTimeout = 5 * time.Second
+)
+
+// Config configures the sql provider, see Register.
+type Config struct {
+	// Query reads the items (DefaultQuery by default). It returns the key, value and optionally priority columns.
+	Query string
+	// Args are the arguments of Query, e.g. to select the rows of a tenant.
+	Args []any
+	// ChangeQuery, if set, is run before Query when polling, and the items are only read again when its result changed.
+	// It returns a single row, e.g. "SELECT MAX(updated_at) FROM configstore". It takes the same arguments as Query.
+	ChangeQuery string
+	// Priority is the priority of the items without a priority column, or with a NULL priority.
+	Priority int64
+	// Timeout is the timeout of the queries (DefaultTimeout by default).
+	Timeout time.Duration
+	// PollInterval, if set, polls the database at that interval.
+	PollInterval time.Duration
+}
+
+func factory(variant string) configstore.ProviderFactoryFunc {
+	return func(s *configstore.Store, spec configstore.ProviderSpec) error {
+		cfg := Config{
+			Query:       spec.Option("query"),
+			ChangeQuery: spec.Option("change-query"),
+		}
+		if cfg.Query == "" {
+			cfg.Query = DefaultQuery
+		}
+		name := spec.Option("name")
+		if name == "" {
+			name = cfg.Query
+		}
+		name = spec.Arg + ":" + name
+		err := checkSpec(spec)
+		var dsn string
+		if err == nil {
+			dsn, err = readDSN(spec.Option("dsn-env"), spec.Option("dsn-file"))
+		}
+		if err == nil {
+			cfg.Timeout, err = spec.DurationOption("timeout", 0)
+		}
+		if err == nil && variant != "" {
+			cfg.PollInterval, err = spec.DurationOption("interval", configstore.DefaultPollInterval)
+		}
+		var db *sql.DB
+		if err == nil {
+			db, err = sql.Open(spec.Arg, dsn)
+		}
+		if err != nil {
+			s.ErrorProvider("sql:"+name, err)
+			return err
+		}
+		err = Register(s, name, db, cfg, spec.ProviderOptions()...)
+		if cfg.PollInterval <= 0 {
+			db.Close()
+		} else {
+			go func() {
+				<-s.Done()
+				db.Close()
+			}()
+		}
+		return err
+	}
+}
+
+// checkSpec checks the driver and the query options, before connecting to the database.
+func checkSpec(spec configstore.ProviderSpec) error {
+	if !slices.Contains(sql.Drivers(), spec.Arg) {
+		return fmt.Errorf("unknown driver '%s' (registered drivers: %s)", spec.Arg, strings.Join(sql.Drivers(), ", "))
+	}
+	for _, option := range []string{"name", "query", "change-query"} {
+		if spec.Options.Has(option) && strings.TrimSpace(spec.Option(option)) == "" {
+			return fmt.Errorf("option '%s' is empty", option)
+		}
+	}
+	return nil
+}
+
+// readDSN reads the data source name from an environment variable, or a file.
+func readDSN(env, file string) (string, error) {
+	switch {
+	case env != "" && file != "":
+		return "", errors.New("options 'dsn-env' and 'dsn-file' are mutually exclusive")
+	case env != "":
+		dsn := os.Getenv(env)
+		if dsn == "" {
+			return "", fmt.Errorf("environment variable '%s' is not set", env)
+		}
+		return dsn, nil
+	case file != "":
+		b, err := os.ReadFile(file)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(string(b)), nil
+	}
+	return "", errors.New("missing option 'dsn-env' or 'dsn-file'")
+}
+
+// client keeps a local copy of the items read from the database.
+type client struct {
+	*configstore.Remote
+	db  *sql.DB
+	cfg Config
+
+	// only used by the goroutine loading the items: the result of the change query, and the items read
+	change string
+	items  []configstore.Item
+	read   bool
+}
+
+// Register registers a provider reading the items from db, named "sql:<name>". The caller keeps ownership of db,
+// which must stay open as long as the provider is polling. If cfg.PollInterval is set, the database is polled
+// until the store is closed, and the watchers get notified when the items change (see configstore.Remote for the
+// handling of failures).
+func Register(s *configstore.Store, name string, db *sql.DB, cfg Config, opts ...configstore.ProviderOption) error {
+	if cfg.Query == "" {
+		cfg.Query = DefaultQuery
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = DefaultTimeout
+	}
+	c := &client{Remote: s.NewRemote("sql:" + name), db: db, cfg: cfg}
+
+	items, err := c.reload(c.Context())
+	if err == nil {
+		c.Set(items...)
+	}
+	err = c.Register(err, cfg.PollInterval > 0, opts...)
+	if cfg.PollInterval > 0 {
+		go c.poll(c.Context())
+	}
+	return err
+}
+
+// poll reloads the items at the configured interval, until ctx is done.
+func (c *client) poll(ctx context.Context) {
+	ticker := time.NewTicker(c.cfg.PollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			items, err := c.reload(ctx)
+			switch {
+			case ctx.Err() != nil:
+				return
+			case err != nil:
+				c.Fail(err)
+			default:
+				c.Update(items...)
+			}
+		}
+	}
+}
+
+// reload reads the items, unless the change query reports they did not change: the last items are returned then.
+func (c *client) reload(ctx context.Context) ([]configstore.Item, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.cfg.Timeout)
+	defer cancel()
+
+	var change string
+	if c.cfg.ChangeQuery != "" {
+		var err error
+		change, err = c.queryChange(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if c.read && change == c.change {
+			return c.items, nil
+		}
+	}
+	items, err := c.load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	c.change, c.items, c.read = change, items, true
+	return items, nil
+}
+
+// queryChange runs the change query, and returns its first row as a string.
+func (c *client) queryChange(ctx context.Context) (string, error) {
+	rows, err := c.db.QueryContext(ctx, c.cfg.ChangeQuery, c.cfg.Args...)
+	if err != nil {
+		return "", fmt.Errorf("sql: change query: %w", err)
+	}
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		return "", fmt.Errorf("sql: change query: %w", err)
+	}
+	values := make([]sql.NullString, len(columns))
+	if rows.Next() {
+		dest := make([]any, len(values))
+		for i := range values {
+			dest[i] = &values[i]
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return "", fmt.Errorf("sql: change query: %w", err)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return "", fmt.Errorf("sql: change query: %w", err)
+	}
+	var b strings.Builder
+	for _, v := range values {
+		fmt.Fprintf(&b, "%t:%q,", v.Valid, v.String)
+	}
+	return b.String(), nil
+}
+
+// load runs the query, and returns the items sorted by key.
+func (c *client) load(ctx context.Context) ([]configstore.Item, error) {
+	rows, err := c.db.QueryContext(ctx, c.cfg.Query, c.cfg.Args...)
+	if err != nil {
+		return nil, fmt.Errorf("sql: query: %w", err)
+	}
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, fmt.Errorf("sql: query: %w", err)
+	}
+	if len(columns) != 2 && len(columns) != 3 {
+		return nil, fmt.Errorf("sql: query: expected 2 or 3 columns (key, value, priority), got %d", len(columns))
+	}
+
+	var items []configstore.Item
+	for rows.Next() {
+		var key, value sql.NullString
+		var priority sql.NullInt64
+		dest := []any{&key, &value, &priority}
+		if err := rows.Scan(dest[:len(columns)]...); err != nil {
+			return nil, fmt.Errorf("sql: query: %w", err)
+		}
+		if !key.Valid || !value.Valid {
+			continue
+		}
+		p := c.cfg.Priority
+		if priority.Valid {
+			p = priority.Int64
+		}
+		items = append(items, configstore.NewItem(key.String, value.String, p))
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("sql: query: %w", err)
+	}
+	sort.SliceStable(items, func(i, j int) bool { return items[i].Key() < items[j].Key() })
+	return items, nil
+}
@@ -0,0 +1,253 @@
+package sqldb
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ovh/configstore"
+	"github.com/ovh/configstore/internal/storetest"
+)
+
+const (
+	tenantQuery = "SELECT name, value, priority FROM config WHERE tenant = ?"
+	changeQuery = "SELECT MAX(updated_at) FROM config"
+)
+
+func init() {
+	sql.Register("fakesql", fakeDriver{})
+}
+
+// fakeDB is an in-memory table of (tenant, name, value, priority) rows, answering a few known queries.
+type fakeDB struct {
+	mut       sync.Mutex
+	rows      [][]driver.Value
+	updatedAt int64
+	queries   map[string]int
+}
+
+// fakeDBs holds the fake databases, by data source name.
+var fakeDBs sync.Map
+
+func newFakeDB(t *testing.T, rows ...[]driver.Value) (*fakeDB, string) {
+	db := &fakeDB{rows: rows, updatedAt: 1, queries: map[string]int{}}
+	dsn := t.Name()
+	fakeDBs.Store(dsn, db)
+	t.Cleanup(func() { fakeDBs.Delete(dsn) })
+	return db, dsn
+}
+
+// update sets the value of a row, and bumps the modification time unless silent is set.
+func (db *fakeDB) update(tenant, name, value string, silent bool) {
+	db.mut.Lock()
+	defer db.mut.Unlock()
+	for _, row := range db.rows {
+		if row[0] == tenant && row[1] == name {
+			row[2] = value
+		}
+	}
+	if !silent {
+		db.updatedAt++
+	}
+}
+
+func (db *fakeDB) count(query string) int {
+	db.mut.Lock()
+	defer db.mut.Unlock()
+	return db.queries[query]
+}
+
+type fakeDriver struct{}
+
+func (fakeDriver) Open(dsn string) (driver.Conn, error) {
+	db, ok := fakeDBs.Load(dsn)
+	if !ok {
+		return nil, fmt.Errorf("unknown database '%s'", dsn)
+	}
+	return fakeConn{db.(*fakeDB)}, nil
+}
+
+type fakeConn struct {
+	db *fakeDB
+}
+
+func (c fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return fakeStmt{c.db, query}, nil
+}
+
+func (fakeConn) Close() error { return nil }
+
+func (fakeConn) Begin() (driver.Tx, error) { return nil, errors.New("transactions are not supported") }
+
+type fakeStmt struct {
+	db    *fakeDB
+	query string
+}
+
+func (fakeStmt) Close() error { return nil }
+
+func (fakeStmt) NumInput() int { return -1 }
+
+func (fakeStmt) Exec([]driver.Value) (driver.Result, error) {
+	return nil, errors.New("exec is not supported")
+}
+
+func (s fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	s.db.mut.Lock()
+	defer s.db.mut.Unlock()
+	s.db.queries[s.query]++
+	switch s.query {
+	case tenantQuery:
+		rows := &fakeRows{columns: []string{"name", "value", "priority"}}
+		for _, row := range s.db.rows {
+			if len(args) == 1 && row[0] == args[0] {
+				rows.values = append(rows.values, append([]driver.Value(nil), row[1:]...))
+			}
+		}
+		return rows, nil
+	case DefaultQuery:
+		return &fakeRows{columns: []string{"name", "value"}, values: [][]driver.Value{{"foo", "bar"}}}, nil
+	case changeQuery:
+		return &fakeRows{columns: []string{"max"}, values: [][]driver.Value{{s.db.updatedAt}}}, nil
+	}
+	return nil, fmt.Errorf("unexpected query '%s'", s.query)
+}
+
+type fakeRows struct {
+	columns []string
+	values  [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string { return r.columns }
+
+func (r *fakeRows) Close() error { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
+
+func TestSQLProvider(t *testing.T) {
+	_, dsn := newFakeDB(t,
+		[]driver.Value{"acme", "db-url", "postgres://acme", int64(20)},
+		[]driver.Value{"acme", "debug", "true", nil},
+		[]driver.Value{"acme", "unset", nil, int64(20)},
+		[]driver.Value{"other", "db-url", "postgres://other", int64(20)},
+	)
+	db, err := sql.Open("fakesql", dsn)
+	require.NoError(t, err)
+	defer db.Close()
+
+	s := configstore.NewStore()
+	defer s.Close()
+	require.NoError(t, Register(s, "acme", db, Config{Query: tenantQuery, Args: []any{"acme"}, Priority: 5}))
+	items, err := s.GetItemList()
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"db-url", "debug"}, items.Keys())
+	i, err := items.GetItem("db-url")
+	require.NoError(t, err)
+	v, err := i.Value()
+	require.NoError(t, err)
+	assert.Equal(t, "postgres://acme", v)
+	assert.Equal(t, int64(20), i.Priority())
+	assert.Equal(t, "sql:acme", i.Provider())
+	i, err = items.GetItem("debug")
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), i.Priority())
+
+	// the priority column is optional
+	s = configstore.NewStore()
+	defer s.Close()
+	require.NoError(t, Register(s, "default", db, Config{}))
+	v, err = s.GetItemValue("foo")
+	require.NoError(t, err)
+	assert.Equal(t, "bar", v)
+
+	// a failing query registers a failing provider
+	s = configstore.NewStore()
+	defer s.Close()
+	assert.Error(t, Register(s, "broken", db, Config{Query: "SELECT nothing"}))
+	_, err = s.GetItemList()
+	assert.Error(t, err)
+}
+
+func TestSQLProviderPoll(t *testing.T) {
+	fake, dsn := newFakeDB(t, []driver.Value{"acme", "foo", "bar", int64(0)})
+	db, err := sql.Open("fakesql", dsn)
+	require.NoError(t, err)
+	defer db.Close()
+
+	s := configstore.NewStore()
+	defer s.Close()
+	ch := s.Watch()
+	cfg := Config{Query: tenantQuery, Args: []any{"acme"}, ChangeQuery: changeQuery, PollInterval: 20 * time.Millisecond}
+	require.NoError(t, Register(s, "acme", db, cfg))
+	storetest.WaitNotification(t, ch)
+
+	// the items are not read again while the change query result is the same
+	fake.update("acme", "foo", "silent", true)
+	require.Eventually(t, func() bool { return fake.count(changeQuery) > 3 }, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, 1, fake.count(tenantQuery))
+	v, err := s.GetItemValue("foo")
+	require.NoError(t, err)
+	assert.Equal(t, "bar", v)
+
+	fake.update("acme", "foo", "baz", false)
+	storetest.WaitNotification(t, ch)
+	v, err = s.GetItemValue("foo")
+	require.NoError(t, err)
+	assert.Equal(t, "baz", v)
+}
+
+func TestSQLFactory(t *testing.T) {
+	_, dsn := newFakeDB(t)
+	t.Setenv("MYAPP_DSN", dsn)
+	t.Setenv(configstore.ConfigEnvVar, "sql:fakesql?dsn-env=MYAPP_DSN&refresh=true&interval=1h")
+
+	s := configstore.NewStore()
+	defer s.Close()
+	require.NoError(t, s.InitFromEnvironment())
+	i, err := s.GetItem("foo")
+	require.NoError(t, err)
+	v, err := i.Value()
+	require.NoError(t, err)
+	assert.Equal(t, "bar", v)
+	assert.Equal(t, "sql:fakesql:"+DefaultQuery, i.Provider())
+
+	// the providers reading the same database are told apart by their name, or their query
+	t.Setenv(configstore.ConfigEnvVar, "sql:fakesql?dsn-env=MYAPP_DSN&name=a,sql:fakesql?dsn-env=MYAPP_DSN&name=b,"+
+		"sql:fakesql?dsn-env=MYAPP_DSN&query=SELECT+name,+value,+priority+FROM+config+WHERE+tenant+=+?")
+	s = configstore.NewStore()
+	defer s.Close()
+	err = s.InitFromEnvironment()
+	assert.ErrorContains(t, err, "unexpected query")
+	assert.NotContains(t, err.Error(), "conflict")
+	status := s.ProviderStatus()
+	assert.Contains(t, status, "sql:fakesql:a")
+	assert.Contains(t, status, "sql:fakesql:b")
+
+	// the options are checked before connecting
+	for _, spec := range []string{
+		"sql:fakesql",
+		"sql:nosuchdriver?dsn-env=MYAPP_DSN",
+		"sql:fakesql?dsn-env=MYAPP_DSN&query=",
+		"sql:fakesql?dsn-env=MYAPP_DSN&change-query=SELECT+1",
+	} {
+		t.Setenv(configstore.ConfigEnvVar, spec)
+		s = configstore.NewStore()
+		defer s.Close()
+		assert.Error(t, s.InitFromEnvironment(), spec)
+	}
+}
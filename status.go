@@ -0,0 +1,90 @@
+package configstore
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// ProviderState describes the state of a registered provider, see Store.ProviderStatus.
+type ProviderState struct {
+	// Kind is the type of provider, e.g. "file+refresh". It is derived from the provider name ("kind:source").
+	Kind string
+	// Source is the provider data source, e.g. a file path.
+	Source string
+	// LastLoad is the time of the last successful load of the provider items.
+	LastLoad time.Time
+	// LastError is the error of the last load attempt, nil if it succeeded.
+	LastError error
+	// ItemCount is the number of items returned by the last successful load.
+	ItemCount int
+	// Watching reports whether the provider watches its source for changes.
+	Watching bool
+	// Degraded reports whether the provider serves its last known good items because its source fails
+	// (see ResilientProvider). LastError holds the source error.
+	Degraded bool
+}
+
+// providerTracker keeps track of the status of a registered provider.
+type providerTracker struct {
+	mut    sync.Mutex
+	status ProviderState
+}
+
+func (p *providerTracker) setName(name string) {
+	kind, source, found := strings.Cut(name, ":")
+	if !found {
+		kind, source = "custom", ""
+	}
+	p.mut.Lock()
+	defer p.mut.Unlock()
+	p.status.Kind = kind
+	p.status.Source = source
+}
+
+func (p *providerTracker) setWatching(watching bool) {
+	p.mut.Lock()
+	defer p.mut.Unlock()
+	p.status.Watching = watching
+}
+
+// record updates the state with the result of a load attempt.
+func (p *providerTracker) record(itemCount int, err error) {
+	p.mut.Lock()
+	defer p.mut.Unlock()
+	p.status.LastError = err
+	p.status.Degraded = false
+	if err == nil {
+		p.status.LastLoad = time.Now()
+		p.status.ItemCount = itemCount
+	}
+}
+
+// recordDegraded updates the state of a provider serving its last known good items.
+func (p *providerTracker) recordDegraded(itemCount int, err error) {
+	p.mut.Lock()
+	defer p.mut.Unlock()
+	p.status.LastError = err
+	p.status.Degraded = true
+	p.status.ItemCount = itemCount
+}
+
+func (p *providerTracker) get() ProviderState {
+	p.mut.Lock()
+	defer p.mut.Unlock()
+	return p.status
+}
+
+// ProviderStatus returns the status of all the registered providers, by provider name.
+// It can be used to expose readiness probes: a provider with a non-nil LastError is serving stale
+// data (refreshing providers) or failing (GetItemList returns an error).
+func (s *Store) ProviderStatus() map[string]ProviderState {
+	s.pMut.Lock()
+	defer s.pMut.Unlock()
+
+	ret := make(map[string]ProviderState, len(s.providers))
+	for n, p := range s.providers {
+		ret[n] = p.state.get()
+	}
+	return ret
+}
@@ -0,0 +1,55 @@
+package configstore
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProviderStatus(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "test.yaml")
+	require.NoError(t, os.WriteFile(filename, []byte("- key: alpha\n  value: bar\n- key: baz\n  value: buz\n"), 0o600))
+
+	s := NewStore()
+	defer s.Close()
+	s.FilePoll(filename, 10*time.Millisecond)
+	s.RegisterProvider("test", ProviderTest2)
+	s.ErrorProvider("broken", errors.New("boom"))
+
+	_, err := s.GetItemList()
+	require.Error(t, err)
+
+	status := s.ProviderStatus()
+	require.Len(t, status, 3)
+
+	fileStatus := status["file+poll:"+filename]
+	assert.Equal(t, "file+poll", fileStatus.Kind)
+	assert.Equal(t, filename, fileStatus.Source)
+	assert.Equal(t, 2, fileStatus.ItemCount)
+	assert.True(t, fileStatus.Watching)
+	assert.NoError(t, fileStatus.LastError)
+	assert.False(t, fileStatus.LastLoad.IsZero())
+
+	assert.Equal(t, "custom", status["broken"].Kind)
+	assert.False(t, status["broken"].Watching)
+
+	// refresh failures are reported while the provider keeps serving its last items
+	ch := s.Watch()
+	s.UnregisterProvider("broken")
+	<-ch
+	require.NoError(t, os.WriteFile(filename, []byte("not: [valid"), 0o600))
+	require.Eventually(t, func() bool {
+		return s.ProviderStatus()["file+poll:"+filename].LastError != nil
+	}, 5*time.Second, 10*time.Millisecond)
+
+	v, err := s.GetItemValue("alpha")
+	require.NoError(t, err)
+	assert.Equal(t, "bar", v)
+	assert.Equal(t, 2, s.ProviderStatus()["file+poll:"+filename].ItemCount)
+	assert.Equal(t, 1, s.ProviderStatus()["test"].ItemCount)
+}
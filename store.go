@@ -5,28 +5,60 @@ import (
 	"errors"
 	"fmt"
 	"os"
-	"strings"
+	"sort"
 	"sync"
 	"time"
 )
 
 type Store struct {
-	providers             map[string]Provider
+	providers             map[string]*providerEntry
+	providersSeq          uint64
 	pMut                  sync.Mutex
 	allowProviderOverride bool
+	ambiguityPolicy       AmbiguityPolicy
+	fetchConcurrency      int
+	persistent            *persistentCache
 
 	watchers      []chan struct{}
 	watchersMut   sync.Mutex
 	watchersNotif bool
 
+	refreshDebounce    time.Duration
+	refreshDebounceMut sync.Mutex
+
 	ctx  context.Context
 	done context.CancelFunc
 }
 
+// providerEntry is a provider registered in a store.
+type providerEntry struct {
+	provider Provider
+	reload   func(context.Context) error
+	state    *providerTracker
+	priority priorityRule
+	// rank and seq (registration order) define the order in which the provider items are merged.
+	rank int
+	seq  uint64
+	// selfReported is set when the provider updates its state on its own (e.g. on refresh),
+	// instead of it being updated on every GetItemList call.
+	selfReported bool
+}
+
+// DefaultFetchConcurrency is the default number of providers called concurrently by GetItemList.
+// Providers are called one at a time by default, since custom providers are not required to be goroutine-safe:
+// stores reading several remote sources should raise it, see SetFetchConcurrency.
+const DefaultFetchConcurrency = 1
+
 func NewStore() *Store {
 	ctx, cancel := context.WithCancel(context.Background())
 
-	return &Store{providers: map[string]Provider{}, watchersNotif: true, ctx: ctx, done: cancel}
+	return &Store{
+		providers:        map[string]*providerEntry{},
+		fetchConcurrency: DefaultFetchConcurrency,
+		watchersNotif:    true,
+		ctx:              ctx,
+		done:             cancel,
+	}
 }
 
 // Close cleans the store resources
@@ -35,64 +67,146 @@ func (s *Store) Close() error {
 	return nil
 }
 
+// Done returns a channel which is closed when the store is closed.
+// Providers running background tasks should stop them at that point.
+func (s *Store) Done() <-chan struct{} {
+	return s.ctx.Done()
+}
+
 /*
 ** PROVIDERS
  */
 
 // InitFromEnvironment initializes configuration providers via their name and an optional argument.
-// Suitable provider factories should have been registered via RegisterProviderFactory for this to work.
-// Built-in providers (File, FileList, FileTree, ...) are registered by default.
+// Suitable provider factories should have been registered via RegisterProviderFactoryInfo for this to work.
+// Built-in providers (File, FileList, FileTree, ...) are registered by default, see ListProviderFactories.
 //
 // Valid example:
 // CONFIGURATION_FROM=file:/etc/myfile.conf,file:/etc/myfile2.conf,filelist:/home/foobar/configs
-func (s *Store) InitFromEnvironment() {
-
-	pFactMut.Lock()
-	defer pFactMut.Unlock()
+//
+// See ProviderSpec for the complete syntax, including options and escaping rules, e.g.
+// CONFIGURATION_FROM=file:/etc/myfile.conf?refresh=true,filetree:"/etc/my,secrets"
+//
+// The returned error aggregates the errors of all the providers which failed to initialize.
+// These providers are registered as error providers, so that GetItemList fails as well.
+func (s *Store) InitFromEnvironment() error {
 
 	cfg := os.Getenv(ConfigEnvVar)
 	if cfg == "" {
-		return
+		return nil
 	}
-	cfgList := strings.Split(cfg, ",")
-	for _, c := range cfgList {
-		parts := strings.SplitN(c, ":", 2)
-		name := c
-		arg := ""
-		if len(parts) > 1 {
-			name = parts[0]
-			arg = parts[1]
-		}
-		name = strings.TrimSpace(name)
-		arg = strings.TrimSpace(arg)
-		f := providerFactories[name]
-		if f == nil {
-			errorProvider(s, fmt.Sprintf("%s:%s", name, arg), errors.New("failed to instantiate provider factory"))
-		} else {
-			f(s, arg)
+	specs, err := parseProviderSpecs(cfg)
+	if err != nil {
+		err = fmt.Errorf("configstore: %s: %w", ConfigEnvVar, err)
+		errorProvider(s, ConfigEnvVar, err)
+		return err
+	}
+
+	var errs []error
+	for _, spec := range specs {
+		if err := s.initProvider(spec); err != nil {
+			errs = append(errs, fmt.Errorf("configstore: %s:%s: %w", spec.Name, spec.Arg, err))
 		}
 	}
+	return errors.Join(errs...)
+}
+
+// initProvider instantiates a provider from its spec. On failure, an error provider is registered.
+func (s *Store) initProvider(spec ProviderSpec) error {
+	spec, err := spec.resolveRefresh()
+	if err != nil {
+		errorProvider(s, fmt.Sprintf("%s:%s", spec.Name, spec.Arg), err)
+		return err
+	}
+	info, ok := getProviderFactory(spec.Name)
+	if !ok {
+		err := errors.New("failed to instantiate provider factory")
+		errorProvider(s, fmt.Sprintf("%s:%s", spec.Name, spec.Arg), err)
+		return err
+	}
+	opts, spec, err := spec.entryOptions()
+	if err != nil {
+		errorProvider(s, fmt.Sprintf("%s:%s", spec.Name, spec.Arg), err)
+		return err
+	}
+	if err := spec.checkOptions(info.Options); err != nil {
+		errorProvider(s, fmt.Sprintf("%s:%s", spec.Name, spec.Arg), err)
+		return err
+	}
+
+	// the priority, rank, cache and retry options are handled for all factories,
+	// which apply them when registering their providers, see ProviderSpec.ProviderOptions
+	spec.entry, spec.entryUsed = opts, new(bool)
+	err = info.Factory(s, spec)
+	if err == nil && opts.hasEntrySettings() && !*spec.entryUsed {
+		err = errors.New("the provider factory does not support the priority, layer, rank, cache and retry options")
+		errorProvider(s, fmt.Sprintf("%s:%s", spec.Name, spec.Arg), err)
+	}
+	return err
 }
 
 const (
 	ProviderConflictErrorLabel = "provider-conflict-error"
 )
 
-// RegisterProvider registers a provider
-func (s *Store) RegisterProvider(name string, f Provider) {
+// RegisterProvider registers a provider.
+// The priority options (PriorityOffset, PriorityClamp, Priority, InLayer) apply to the items it returns.
+func (s *Store) RegisterProvider(name string, f Provider, opts ...ProviderOption) {
+	s.registerProvider(name, providerOptions{}.apply(opts).entry(s, &providerEntry{provider: f}))
+}
+
+// RegisterReloadableProvider registers a provider which is able to re-read its source on demand, see Reload().
+func (s *Store) RegisterReloadableProvider(name string, p Reloadable, opts ...ProviderOption) {
+	s.registerProvider(name, providerOptions{}.apply(opts).entry(s, &providerEntry{provider: p.Items, reload: p.Reload}))
+}
+
+func (s *Store) registerProvider(name string, e *providerEntry) {
 	switch name {
 	case ProviderConflictErrorLabel:
 		return
 	}
+	if e.state == nil {
+		e.state = &providerTracker{}
+	}
+	e.state.setName(name)
 	s.pMut.Lock()
 	defer s.pMut.Unlock()
 	defer s.NotifyWatchers()
-	_, ok := s.providers[name]
+	prev, ok := s.providers[name]
 	if ok && !s.allowProviderOverride {
-		s.providers[ProviderConflictErrorLabel] = newErrorProvider(fmt.Errorf("configstore: conflict on configuration provider: %s", name))
+		err := fmt.Errorf("configstore: conflict on configuration provider: %s", name)
+		state := &providerTracker{}
+		state.setName(ProviderConflictErrorLabel)
+		state.record(0, err)
+		s.providersSeq++
+		s.providers[ProviderConflictErrorLabel] = &providerEntry{provider: newErrorProvider(err), state: state, seq: s.providersSeq}
 		return
 	}
-	s.providers[name] = f
+	if ok {
+		// an overridden provider keeps its position
+		e.seq = prev.seq
+	} else {
+		s.providersSeq++
+		e.seq = s.providersSeq
+	}
+	s.providers[name] = e
+}
+
+// orderedProviders returns the names of the registered providers, in merge order: by rank, then by registration order.
+// It must be called with pMut held.
+func (s *Store) orderedProviders() []string {
+	names := make([]string, 0, len(s.providers))
+	for n := range s.providers {
+		names = append(names, n)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		pi, pj := s.providers[names[i]], s.providers[names[j]]
+		if pi.rank != pj.rank {
+			return pi.rank < pj.rank
+		}
+		return pi.seq < pj.seq
+	})
+	return names
 }
 
 // UnregisterProvider unregisters a provider
@@ -119,23 +233,30 @@ func (s *Store) ErrorProvider(name string, err error) {
 }
 
 // File registers a configstore provider which reads from the file given in parameter (static content).
-func (s *Store) File(filename string) {
-	fileProvider(s, filename)
+func (s *Store) File(filename string, opts ...ProviderOption) {
+	_ = file(s, filename, providerOptions{}.apply(opts), nil)
 }
 
 // FileRefresh registers a configstore provider which readfs from the file given in parameter (provider watches file stat for auto refresh, watchers get notified).
-func (s *Store) FileRefresh(filename string) {
-	fileRefreshProvider(s, filename)
+// If filesystem notifications are not available for that file, the provider falls back to polling (see FilePoll).
+func (s *Store) FileRefresh(filename string, opts ...ProviderOption) {
+	_ = file(s, filename, providerOptions{refresh: refreshNotify}.apply(opts), nil)
+}
+
+// FilePoll registers a configstore provider which reads from the file given in parameter (provider polls file stat and content
+// at the given interval for auto refresh, watchers get notified). This is suitable for filesystems without notification support (NFS, ...).
+func (s *Store) FilePoll(filename string, interval time.Duration, opts ...ProviderOption) {
+	_ = file(s, filename, providerOptions{refresh: refreshPoll, pollInterval: interval}.apply(opts), nil)
 }
 
 // FileCustom registers a configstore provider which reads from the file given in parameter, and loads the content using the given unmarshal function
-func (s *Store) FileCustom(filename string, fn func([]byte) ([]Item, error)) {
-	fileCustomProvider(s, filename, fn)
+func (s *Store) FileCustom(filename string, fn func([]byte) ([]Item, error), opts ...ProviderOption) {
+	_ = file(s, filename, providerOptions{}.apply(opts), fn)
 }
 
 // FileCustomRefresh registers a configstore provider which reads from the file given in parameter, and loads the content using the given unmarshal function; and watches file stat for auto refresh
-func (s *Store) FileCustomRefresh(filename string, fn func([]byte) ([]Item, error)) {
-	fileCustomRefreshProvider(s, filename, fn)
+func (s *Store) FileCustomRefresh(filename string, fn func([]byte) ([]Item, error), opts ...ProviderOption) {
+	_ = file(s, filename, providerOptions{refresh: refreshNotify}.apply(opts), fn)
 }
 
 // FileTree registers a configstore provider which reads from the files contained in the directory given in parameter.
@@ -144,40 +265,56 @@ func (s *Store) FileCustomRefresh(filename string, fn func([]byte) ([]Item, erro
 // The content of the files should be the plain data, with no envelope.
 // Capitalization can be used to indicate item priority for sub-directories containing multiple items which should be differentiated.
 // Capitalized = higher priority.
-func (s *Store) FileTree(dirname string) {
-	fileTreeProvider(s, dirname)
+// Explicit priority, sensitivity, content encoding (raw or base64) and description can be set for a file or sub-directory
+// with a "<name>.meta.yaml" sidecar file, or for a whole directory with a ".configstore.yaml" file.
+func (s *Store) FileTree(dirname string, opts ...ProviderOption) {
+	_ = fileTree(s, dirname, providerOptions{}.apply(opts))
 }
 
 // FileTreeRefresh is similar to the FileTree provider with the refresh feature enabled.
 // Updates can be handled with the `Watch()` function.
-func (s *Store) FileTreeRefresh(dirname string) {
-	fileTreeRefreshProvider(s, dirname)
+func (s *Store) FileTreeRefresh(dirname string, opts ...ProviderOption) {
+	_ = fileTree(s, dirname, providerOptions{refresh: refreshNotify}.apply(opts))
+}
+
+// FileTreePoll is similar to the FileTree provider with the refresh feature enabled, using polling at the given interval
+// instead of filesystem notifications.
+// Updates can be handled with the `Watch()` function.
+func (s *Store) FileTreePoll(dirname string, interval time.Duration, opts ...ProviderOption) {
+	_ = fileTree(s, dirname, providerOptions{refresh: refreshPoll, pollInterval: interval}.apply(opts))
 }
 
 // FileList registers a configstore provider which reads from the files contained in the directory given in parameter.
 // The content of the files should be JSON/YAML similar to the File provider.
-func (s *Store) FileList(dirname string) {
-	fileListProvider(s, dirname)
+func (s *Store) FileList(dirname string, opts ...ProviderOption) {
+	_ = fileList(s, dirname, providerOptions{}.apply(opts))
 }
 
 // FileListRefresh is similar to the FileList provider with the refresh feature enabled.
 // Updates can be handled with the `Watch()` function.
-func (s *Store) FileListRefresh(dirname string) {
-	fileListRefreshProvider(s, dirname)
+func (s *Store) FileListRefresh(dirname string, opts ...ProviderOption) {
+	_ = fileList(s, dirname, providerOptions{refresh: refreshNotify}.apply(opts))
+}
+
+// FileListPoll is similar to the FileList provider with the refresh feature enabled, using polling at the given interval
+// instead of filesystem notifications.
+// Updates can be handled with the `Watch()` function.
+func (s *Store) FileListPoll(dirname string, interval time.Duration, opts ...ProviderOption) {
+	_ = fileList(s, dirname, providerOptions{refresh: refreshPoll, pollInterval: interval}.apply(opts))
 }
 
 // InMemory registers an InMemoryProvider with a given arbitrary name and returns it.
 // You can append any number of items to it, see Add().
-func (s *Store) InMemory(name string) *InMemoryProvider {
-	return inMemoryProvider(s, name)
+func (s *Store) InMemory(name string, opts ...ProviderOption) *InMemoryProvider {
+	return inMemoryProvider(s, name, providerOptions{}.apply(opts))
 }
 
 // Env registers a provider reading from the environment.
 // Only variables beginning with "PREFIX_" will be considered.
 // Trimmed variable names are used as keys. Keys are not case-sensitive.
 // Underscores (_) in variable names are considered equivalent to dashes (-).
-func (s *Store) Env(prefix string) {
-	envProvider(s, prefix)
+func (s *Store) Env(prefix string, opts ...ProviderOption) {
+	env(s, prefix, providerOptions{}.apply(opts))
 }
 
 /*
@@ -241,31 +378,185 @@ func (s *Store) NotifyIsMuted() bool {
 	return !s.watchersNotif
 }
 
+// SetRefreshDebounce sets the delay used by the refreshing providers to coalesce bursts of change events
+// (partial writes, several files updated at once, ...) into a single reload.
+// A zero delay (the default) reloads on every event. Watchers are only notified if the reloaded items differ.
+func (s *Store) SetRefreshDebounce(d time.Duration) {
+	s.refreshDebounceMut.Lock()
+	defer s.refreshDebounceMut.Unlock()
+	s.refreshDebounce = d
+}
+
+func (s *Store) getRefreshDebounce() time.Duration {
+	s.refreshDebounceMut.Lock()
+	defer s.refreshDebounceMut.Unlock()
+	return s.refreshDebounce
+}
+
 /*
 ** GETTERS
  */
 
 // GetItemList retrieves the full item list, merging the results from all providers.
+// Providers are merged by rank (see Rank), then in registration order, and items are stable sorted by priority:
+// items sharing the same priority keep that order.
 // It does NOT cache, it's the responsability of the providers to keep an in-ram representation if desired.
+// Providers can be called concurrently (see SetFetchConcurrency), and their items are merged in a deterministic order.
+// If a provider fails, the error is an ErrProvider; if several providers fail, it is an ErrProviders.
 func (s *Store) GetItemList() (*ItemList, error) {
 
 	s.pMut.Lock()
-	defer s.pMut.Unlock()
+	names := s.orderedProviders()
+	entries := make([]*providerEntry, len(names))
+	for i, n := range names {
+		entries[i] = s.providers[n]
+	}
+	ret := &ItemList{policy: s.ambiguityPolicy}
+	workers := s.fetchConcurrency
+	persistent := s.persistent
+	s.pMut.Unlock()
+
+	// providers are called without holding pMut, so that they can register other providers
+	results := fetchProviders(entries, workers)
+
+	var errs ErrProviders
+	for origin, n := range names {
+		if err := results[origin].err; err != nil {
+			errs = append(errs, ErrProvider{Provider: n, Err: err})
+		}
+	}
+	var err error
+	switch len(errs) {
+	case 0:
+		ret.Items = mergeItems(names, entries, results, nil)
+		if persistent != nil {
+			persistent.save(ret.Items)
+		}
+		return ret.index(), nil
+	case 1:
+		err = errs[0]
+	default:
+		err = errs
+	}
+	if persistent != nil {
+		if saved := persistent.load(); saved != nil {
+			// the failed providers are replaced by their saved items
+			logError(err)
+			ret.Items = mergeItems(names, entries, results, saved)
+			return ret.index(), nil
+		}
+	}
+	return nil, err
+}
+
+// mergeItems concatenates the items of the providers, in order. The items of a failed provider are taken from saved,
+// where they are already adjusted.
+func mergeItems(names []string, entries []*providerEntry, results []fetchResult, saved map[string][]Item) []Item {
+	var items []Item
+	for origin, n := range names {
+		if results[origin].err != nil {
+			for _, it := range saved[n] {
+				it.origin = origin
+				items = append(items, it)
+			}
+			continue
+		}
+		for _, it := range results[origin].items.Items {
+			it.priority = entries[origin].priority.adjust(it.priority)
+			it.provider = n
+			it.origin = origin
+			items = append(items, it)
+		}
+	}
+	return items
+}
 
-	ret := &ItemList{}
+type fetchResult struct {
+	items ItemList
+	err   error
+}
 
-	for n, p := range s.providers {
-		l, err := p()
-		if err != nil {
-			return nil, ErrProvider(fmt.Sprintf("configstore: provider '%s': %v", n, err))
+// fetchProviders calls the providers, with at most workers concurrent calls, and returns their results in order.
+func fetchProviders(entries []*providerEntry, workers int) []fetchResult {
+	results := make([]fetchResult, len(entries))
+	fetch := func(i int) {
+		p := entries[i]
+		l, err := p.provider()
+		var degraded ErrDegraded
+		switch {
+		case errors.As(err, &degraded):
+			// the last known good items are served
+			p.state.recordDegraded(len(l.Items), degraded.Err)
+			err = nil
+		case !p.selfReported:
+			p.state.record(len(l.Items), err)
+		}
+		results[i] = fetchResult{items: l, err: err}
+	}
+
+	if workers > len(entries) {
+		workers = len(entries)
+	}
+	if workers <= 1 {
+		for i := range entries {
+			fetch(i)
 		}
-		ret.Items = append(ret.Items, l.Items...)
+		return results
+	}
+
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				fetch(i)
+			}
+		}()
+	}
+	for i := range entries {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+	return results
+}
+
+// SetFetchConcurrency sets the maximum number of providers called concurrently by GetItemList
+// (DefaultFetchConcurrency by default). A value of 1 or less calls the providers one at a time.
+// With a higher value, the providers may be called from several goroutines, and must be goroutine-safe.
+// It can also be set from the ConfigEnvVar environment variable, with "store:?fetch-concurrency=<n>".
+func (s *Store) SetFetchConcurrency(n int) {
+	s.pMut.Lock()
+	defer s.pMut.Unlock()
+	s.fetchConcurrency = n
+}
+
+// storeFactory applies the store settings given in the ConfigEnvVar environment variable.
+func storeFactory(s *Store, spec ProviderSpec) error {
+	var err error
+	if spec.Arg != "" {
+		err = fmt.Errorf("unexpected argument '%s'", spec.Arg)
 	}
-	return ret.index(), nil
+	var n int64
+	if err == nil {
+		n, err = spec.IntOption("fetch-concurrency", DefaultFetchConcurrency)
+	}
+	if err == nil && n < 1 {
+		err = fmt.Errorf("option 'fetch-concurrency': must be at least 1")
+	}
+	if err != nil {
+		errorProvider(s, "store:"+spec.Arg, err)
+		return err
+	}
+	s.SetFetchConcurrency(int(n))
+	return nil
 }
 
 // GetItem retrieves the full item list, merging the results from all providers, then returns a single item by key.
-// If 0 or >=2 items are present with that key, it will return an error.
+// If 0 or >=2 items are present with that key, it will return an error, unless the store ambiguity policy resolves it
+// (see SetAmbiguityPolicy).
 func (s *Store) GetItem(key string) (Item, error) {
 	items, err := s.GetItemList()
 	if err != nil {
@@ -0,0 +1,476 @@
+// Package vault provides a configstore provider reading a secret from a Vault KV version 2 mount.
+//
+// Each field of the secret becomes an item flagged as sensitive. The client authenticates with a token
+// (VAULT_TOKEN, or a token file kept up to date by an agent) or with AppRole, and renews its token and the secret
+// lease, if any, before they expire.
+//
+// Importing the package registers the "vault" provider factory, whose argument is the mount followed by the secret path:
+//
+//	CONFIGURATION_FROM=vault:secret/myapp/db?refresh=true&interval=5m&address=https://vault.internal:8200
+//
+// The refreshing variant re-reads the secret at the given interval, and notifies the watchers when it changes.
+package vault
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ovh/configstore"
+)
+
+func init() {
+	options := []string{"address", "namespace", "token-file", "role-id", "secret-id-file", "approle-mount"}
+	configstore.RegisterProviderFactoryInfo(configstore.ProviderFactoryInfo{
+		Name:        "vault",
+		Description: "Reads the fields of a Vault KV v2 secret.",
+		Syntax:      "vault:<mount>/<path>",
+		Examples:    []string{"vault:secret/myapp/db?address=https://vault.internal:8200"},
+		Options:     options,
+		Factory:     factory(false),
+	})
+	configstore.RegisterProviderFactoryInfo(configstore.ProviderFactoryInfo{
+		Name:        "vault+refresh",
+		Description: "Reads the fields of a Vault KV v2 secret, and re-reads it at the given interval.",
+		Syntax:      "vault+refresh:<mount>/<path>",
+		Examples:    []string{"vault+refresh:secret/myapp/db?interval=1m&role-id=myapp&secret-id-file=/run/secrets/secret-id"},
+		Options:     append([]string{"interval", "retry-delay"}, options...),
+		Factory:     factory(true),
+	})
+}
+
+const (
+	// DefaultAddress is the address of the Vault server, when neither Config.Address nor VAULT_ADDR are set.
+	DefaultAddress = "https://127.0.0.1:8200"
+	// DefaultInterval is the default interval between two reads of the secret, for the refreshing variant.
+	DefaultInterval = 5 * time.Minute
+	// DefaultRetryDelay is the default delay before the next read, after a failure.
+	DefaultRetryDelay = 5 * time.Second
+)
+
+// Config configures the vault provider, see Register.
+type Config struct {
+	// Address is the address of the Vault server (VAULT_ADDR, or DefaultAddress by default).
+	Address string
+	// Namespace is the Vault Enterprise namespace (VAULT_NAMESPACE by default).
+	Namespace string
+	// Token is the client token (VAULT_TOKEN by default). It is renewed before it expires, if renewable.
+	Token string
+	// TokenFile is the path of a file holding the client token, e.g. written by a Vault agent.
+	// It is read before each request, and never renewed by the provider.
+	TokenFile string
+	// RoleID and SecretID (or SecretIDFile) select the AppRole authentication. The token obtained at login is renewed
+	// before it expires, and the provider logs in again when it cannot be renewed anymore.
+	RoleID       string
+	SecretID     string
+	SecretIDFile string
+	// AppRoleMount is the mount of the AppRole auth method ("approle" by default).
+	AppRoleMount string
+	// HTTPClient is the client used for the requests (http.DefaultClient by default).
+	HTTPClient *http.Client
+	// Priority is the priority of the items.
+	Priority int64
+	// Interval is the interval between two reads of the secret. If zero, the secret is read once.
+	Interval time.Duration
+	// RetryDelay is the delay before the next read after a failure (DefaultRetryDelay by default).
+	RetryDelay time.Duration
+}
+
+func factory(refresh bool) configstore.ProviderFactoryFunc {
+	return func(s *configstore.Store, spec configstore.ProviderSpec) error {
+		cfg := Config{
+			Address:      spec.Option("address"),
+			Namespace:    spec.Option("namespace"),
+			TokenFile:    spec.Option("token-file"),
+			RoleID:       spec.Option("role-id"),
+			SecretIDFile: spec.Option("secret-id-file"),
+			AppRoleMount: spec.Option("approle-mount"),
+		}
+		var err error
+		if refresh {
+			cfg.Interval, err = spec.DurationOption("interval", DefaultInterval)
+			if err == nil {
+				cfg.RetryDelay, err = spec.DurationOption("retry-delay", 0)
+			}
+		}
+		if err != nil {
+			s.ErrorProvider("vault:"+spec.Arg, err)
+			return err
+		}
+		return Register(s, spec.Arg, cfg, spec.ProviderOptions()...)
+	}
+}
+
+// client keeps a local copy of the fields of a secret.
+type client struct {
+	*configstore.Remote
+	path   string
+	mount  string
+	secret string
+	cfg    Config
+
+	mut     sync.Mutex
+	token   string
+	renewAt time.Time // zero if the token is not renewed
+	leaseID string
+	leaseAt time.Time // zero if there is no lease to renew
+}
+
+// Register registers a provider reading the fields of the secret at path ("<mount>/<secret path>"), named "vault:<path>".
+// If cfg.Interval is set, the secret is re-read at that interval until the store is closed, and the watchers get
+// notified when it changes (see configstore.Remote for the handling of failures).
+func Register(s *configstore.Store, path string, cfg Config, opts ...configstore.ProviderOption) error {
+	if cfg.Address == "" {
+		cfg.Address = os.Getenv("VAULT_ADDR")
+	}
+	if cfg.Address == "" {
+		cfg.Address = DefaultAddress
+	}
+	cfg.Address = strings.TrimSuffix(cfg.Address, "/")
+	if cfg.Namespace == "" {
+		cfg.Namespace = os.Getenv("VAULT_NAMESPACE")
+	}
+	if cfg.Token == "" && cfg.TokenFile == "" && cfg.RoleID == "" {
+		cfg.Token = os.Getenv("VAULT_TOKEN")
+	}
+	if cfg.AppRoleMount == "" {
+		cfg.AppRoleMount = "approle"
+	}
+	if cfg.HTTPClient == nil {
+		cfg.HTTPClient = http.DefaultClient
+	}
+	if cfg.RetryDelay <= 0 {
+		cfg.RetryDelay = DefaultRetryDelay
+	}
+	name := "vault:" + path
+
+	path = strings.Trim(path, "/")
+	mount, secret, ok := strings.Cut(path, "/")
+	if !ok || secret == "" {
+		err := fmt.Errorf("vault: %s: expected <mount>/<path>", path)
+		s.ErrorProvider(name, err)
+		return err
+	}
+	c := &client{Remote: s.NewRemote(name), path: path, mount: mount, secret: secret, cfg: cfg, token: cfg.Token}
+
+	err := c.authenticate(c.Context())
+	var items []configstore.Item
+	if err == nil {
+		items, err = c.read(c.Context())
+	}
+	loaded := err == nil
+	if loaded {
+		c.Set(items...)
+	}
+	err = c.Register(err, cfg.Interval > 0, opts...)
+	if cfg.Interval > 0 {
+		go c.follow(c.Context(), loaded)
+	}
+	return err
+}
+
+// follow re-reads the secret at the configured interval, and renews the token and the lease in between, until ctx is done.
+func (c *client) follow(ctx context.Context, loaded bool) {
+	nextRead := time.Now().Add(c.cfg.Interval)
+	if !loaded {
+		nextRead = time.Now().Add(c.cfg.RetryDelay)
+	}
+	for {
+		next := nextRead
+		c.mut.Lock()
+		renewAt, leaseAt := c.renewAt, c.leaseAt
+		c.mut.Unlock()
+		if !renewAt.IsZero() && renewAt.Before(next) {
+			next = renewAt
+		}
+		if !leaseAt.IsZero() && leaseAt.Before(next) {
+			next = leaseAt
+		}
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		now := time.Now()
+		if !renewAt.IsZero() && !renewAt.After(now) {
+			if err := c.renewToken(ctx); err != nil {
+				c.Fail(err)
+			}
+		}
+		if !leaseAt.IsZero() && !leaseAt.After(now) {
+			if err := c.renewLease(ctx); err != nil {
+				// the lease is lost, read the secret again
+				c.Fail(err)
+				nextRead = now
+			}
+		}
+		if nextRead.After(now) {
+			continue
+		}
+		items, err := c.read(ctx)
+		switch {
+		case ctx.Err() != nil:
+			return
+		case err != nil:
+			c.Fail(err)
+			nextRead = now.Add(c.cfg.RetryDelay)
+		default:
+			nextRead = now.Add(c.cfg.Interval)
+			c.Update(items...)
+		}
+	}
+}
+
+// authenticate obtains the client token, and schedules its renewal.
+func (c *client) authenticate(ctx context.Context) error {
+	switch {
+	case c.cfg.RoleID != "":
+		return c.login(ctx)
+	case c.cfg.TokenFile != "":
+		return nil
+	case c.cfg.Token == "":
+		return errors.New("vault: " + c.path + ": no token")
+	}
+	var resp struct {
+		Data struct {
+			TTL       int64 `json:"ttl"`
+			Renewable bool  `json:"renewable"`
+		} `json:"data"`
+	}
+	if err := c.request(ctx, http.MethodGet, "/v1/auth/token/lookup-self", nil, &resp); err != nil {
+		// the token may not be allowed to look itself up: it is just not renewed
+		c.Fail(err)
+		return nil
+	}
+	if resp.Data.Renewable {
+		c.mut.Lock()
+		c.renewAt = renewTime(resp.Data.TTL)
+		c.mut.Unlock()
+	}
+	return nil
+}
+
+// authResponse is the response of the login and token renewal endpoints.
+type authResponse struct {
+	Auth struct {
+		ClientToken   string `json:"client_token"`
+		LeaseDuration int64  `json:"lease_duration"`
+		Renewable     bool   `json:"renewable"`
+	} `json:"auth"`
+}
+
+// login authenticates with AppRole.
+func (c *client) login(ctx context.Context) error {
+	secretID := c.cfg.SecretID
+	if c.cfg.SecretIDFile != "" {
+		b, err := os.ReadFile(c.cfg.SecretIDFile)
+		if err != nil {
+			return err
+		}
+		secretID = strings.TrimSpace(string(b))
+	}
+	body := map[string]string{"role_id": c.cfg.RoleID, "secret_id": secretID}
+	var resp authResponse
+	if err := c.request(ctx, http.MethodPost, "/v1/auth/"+c.cfg.AppRoleMount+"/login", body, &resp); err != nil {
+		return err
+	}
+	if resp.Auth.ClientToken == "" {
+		return errors.New("vault: " + c.path + ": login: no client token")
+	}
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	c.token = resp.Auth.ClientToken
+	c.renewAt = time.Time{}
+	if resp.Auth.Renewable {
+		c.renewAt = renewTime(resp.Auth.LeaseDuration)
+	}
+	return nil
+}
+
+// renewToken extends the client token. With AppRole, the provider logs in again when the token cannot be renewed.
+func (c *client) renewToken(ctx context.Context) error {
+	var resp authResponse
+	err := c.request(ctx, http.MethodPost, "/v1/auth/token/renew-self", map[string]string{}, &resp)
+	if err == nil && resp.Auth.Renewable && resp.Auth.LeaseDuration > 0 {
+		c.mut.Lock()
+		c.renewAt = renewTime(resp.Auth.LeaseDuration)
+		c.mut.Unlock()
+		return nil
+	}
+	if c.cfg.RoleID != "" {
+		return c.login(ctx)
+	}
+	c.mut.Lock()
+	c.renewAt = time.Time{}
+	c.mut.Unlock()
+	return err
+}
+
+// renewLease extends the lease of the secret.
+func (c *client) renewLease(ctx context.Context) error {
+	c.mut.Lock()
+	leaseID := c.leaseID
+	c.mut.Unlock()
+
+	var resp struct {
+		LeaseDuration int64 `json:"lease_duration"`
+		Renewable     bool  `json:"renewable"`
+	}
+	err := c.request(ctx, http.MethodPut, "/v1/sys/leases/renew", map[string]string{"lease_id": leaseID}, &resp)
+
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	c.leaseAt = time.Time{}
+	if err != nil {
+		return err
+	}
+	if resp.Renewable {
+		c.leaseAt = renewTime(resp.LeaseDuration)
+	}
+	return nil
+}
+
+// read reads the secret, and returns its fields as items.
+func (c *client) read(ctx context.Context) ([]configstore.Item, error) {
+	var resp struct {
+		LeaseID       string `json:"lease_id"`
+		LeaseDuration int64  `json:"lease_duration"`
+		Renewable     bool   `json:"renewable"`
+		Data          struct {
+			Data map[string]any `json:"data"`
+		} `json:"data"`
+	}
+	endpoint := "/v1/" + c.mount + "/data/" + c.secret
+	err := c.request(ctx, http.MethodGet, endpoint, nil, &resp)
+	var se *statusError
+	if errors.As(err, &se) && se.code == http.StatusForbidden && c.cfg.RoleID != "" {
+		// the token expired or was revoked
+		if err = c.login(ctx); err == nil {
+			err = c.request(ctx, http.MethodGet, endpoint, nil, &resp)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]configstore.Item, 0, len(resp.Data.Data))
+	for _, field := range slices.Sorted(maps.Keys(resp.Data.Data)) {
+		v := resp.Data.Data[field]
+		value, ok := v.(string)
+		if !ok {
+			b, err := json.Marshal(v)
+			if err != nil {
+				return nil, fmt.Errorf("vault: %s: field '%s': %w", c.path, field, err)
+			}
+			value = string(b)
+		}
+		items = append(items, configstore.NewItem(field, value, c.cfg.Priority).WithSensitive(true))
+	}
+
+	c.mut.Lock()
+	c.leaseID, c.leaseAt = "", time.Time{}
+	if resp.LeaseID != "" && resp.Renewable {
+		c.leaseID, c.leaseAt = resp.LeaseID, renewTime(resp.LeaseDuration)
+	}
+	c.mut.Unlock()
+	return items, nil
+}
+
+// statusError is returned for unexpected response statuses.
+type statusError struct {
+	code int
+	msg  string
+}
+
+func (e *statusError) Error() string {
+	return e.msg
+}
+
+// request calls the Vault API, and decodes the response into out.
+func (c *client) request(ctx context.Context, method, endpoint string, body, out any) error {
+	var payload io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		payload = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.cfg.Address+endpoint, payload)
+	if err != nil {
+		return err
+	}
+	token, err := c.currentToken()
+	if err != nil {
+		return err
+	}
+	if token != "" {
+		req.Header.Set("X-Vault-Token", token)
+	}
+	if c.cfg.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", c.cfg.Namespace)
+	}
+
+	resp, err := c.cfg.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return fmt.Errorf("vault: %s: %w", endpoint, err)
+		}
+		return nil
+	case http.StatusNoContent:
+		return nil
+	case http.StatusNotFound:
+		return fmt.Errorf("vault: %s: %w", endpoint, fs.ErrNotExist)
+	}
+	var vaultErr struct {
+		Errors []string `json:"errors"`
+	}
+	msg := resp.Status
+	if json.NewDecoder(resp.Body).Decode(&vaultErr) == nil && len(vaultErr.Errors) > 0 {
+		msg += ": " + strings.Join(vaultErr.Errors, ", ")
+	}
+	return &statusError{code: resp.StatusCode, msg: "vault: " + endpoint + ": " + msg}
+}
+
+// currentToken returns the client token, read from the token file if any.
+func (c *client) currentToken() (string, error) {
+	if c.cfg.TokenFile != "" && c.cfg.RoleID == "" {
+		b, err := os.ReadFile(c.cfg.TokenFile)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(string(b)), nil
+	}
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	return c.token, nil
+}
+
+// renewTime returns when a token or lease of the given duration (in seconds) should be renewed.
+func renewTime(ttl int64) time.Time {
+	if ttl <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(time.Duration(ttl) * time.Second * 2 / 3)
+}
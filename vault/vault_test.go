@@ -0,0 +1,186 @@
+package vault
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ovh/configstore"
+	"github.com/ovh/configstore/internal/storetest"
+)
+
+// fakeVault mimics the few Vault endpoints used by the provider.
+type fakeVault struct {
+	mut       sync.Mutex
+	tokens    map[string]bool
+	secret    map[string]any
+	ttl       int64
+	logins    int
+	renewals  int
+	namespace string
+}
+
+func newFakeVault(secret map[string]any) *fakeVault {
+	return &fakeVault{tokens: map[string]bool{"root": true}, secret: secret, ttl: 3600}
+}
+
+func (f *fakeVault) setSecret(secret map[string]any) {
+	f.mut.Lock()
+	defer f.mut.Unlock()
+	f.secret = secret
+}
+
+func (f *fakeVault) revoke(token string) {
+	f.mut.Lock()
+	defer f.mut.Unlock()
+	delete(f.tokens, token)
+}
+
+func (f *fakeVault) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mut.Lock()
+	defer f.mut.Unlock()
+	f.namespace = r.Header.Get("X-Vault-Namespace")
+
+	reply := func(v any) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(v)
+	}
+	auth := func(token string) map[string]any {
+		return map[string]any{"auth": map[string]any{"client_token": token, "lease_duration": f.ttl, "renewable": true}}
+	}
+
+	if r.URL.Path == "/v1/auth/approle/login" {
+		var body map[string]string
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		if body["role_id"] != "myapp" || body["secret_id"] != "s3cr3t" {
+			w.WriteHeader(http.StatusBadRequest)
+			reply(map[string]any{"errors": []string{"invalid role or secret ID"}})
+			return
+		}
+		f.logins++
+		token := "approle-" + strconv.Itoa(f.logins)
+		f.tokens[token] = true
+		reply(auth(token))
+		return
+	}
+
+	token := r.Header.Get("X-Vault-Token")
+	if !f.tokens[token] {
+		w.WriteHeader(http.StatusForbidden)
+		reply(map[string]any{"errors": []string{"permission denied"}})
+		return
+	}
+	switch r.URL.Path {
+	case "/v1/auth/token/lookup-self":
+		reply(map[string]any{"data": map[string]any{"ttl": f.ttl, "renewable": true}})
+	case "/v1/auth/token/renew-self":
+		f.renewals++
+		reply(auth(token))
+	case "/v1/secret/data/myapp/db":
+		reply(map[string]any{"data": map[string]any{"data": f.secret, "metadata": map[string]any{"version": 1}}})
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		reply(map[string]any{"errors": []string{}})
+	}
+}
+
+func TestVaultProvider(t *testing.T) {
+	fake := newFakeVault(map[string]any{"password": "hunter2", "port": 5432})
+	ts := httptest.NewServer(fake)
+	defer ts.Close()
+
+	s := configstore.NewStore()
+	defer s.Close()
+	require.NoError(t, Register(s, "secret/myapp/db", Config{Address: ts.URL, Token: "root", Namespace: "team", Priority: 4}))
+	assert.Equal(t, "team", fake.namespace)
+
+	items, err := s.GetItemList()
+	require.NoError(t, err)
+	require.Equal(t, 2, items.Len())
+	i, err := items.GetItem("password")
+	require.NoError(t, err)
+	v, _ := i.Value()
+	assert.Equal(t, "hunter2", v)
+	assert.True(t, i.Sensitive())
+	assert.Equal(t, int64(4), i.Priority())
+	assert.Equal(t, "vault:secret/myapp/db", i.Provider())
+	v, err = items.GetItemValue("port")
+	require.NoError(t, err)
+	assert.Equal(t, "5432", v)
+
+	// a missing secret, or a denied access, registers a failing provider
+	s = configstore.NewStore()
+	defer s.Close()
+	assert.Error(t, Register(s, "secret/myapp/other", Config{Address: ts.URL, Token: "root"}))
+	assert.Error(t, Register(s, "secret/myapp/db", Config{Address: ts.URL, Token: "nope"}))
+	assert.Error(t, Register(s, "secret", Config{Address: ts.URL, Token: "root"}))
+	_, err = s.GetItemList()
+	assert.Error(t, err)
+}
+
+func TestVaultProviderTokenFile(t *testing.T) {
+	fake := newFakeVault(map[string]any{"password": "hunter2"})
+	ts := httptest.NewServer(fake)
+	defer ts.Close()
+
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	require.NoError(t, os.WriteFile(tokenFile, []byte("root\n"), 0o600))
+
+	s := configstore.NewStore()
+	defer s.Close()
+	require.NoError(t, Register(s, "secret/myapp/db", Config{Address: ts.URL, TokenFile: tokenFile}))
+	v, err := s.GetItemValue("password")
+	require.NoError(t, err)
+	assert.Equal(t, "hunter2", v)
+}
+
+func TestVaultProviderAppRoleRefresh(t *testing.T) {
+	fake := newFakeVault(map[string]any{"password": "hunter2"})
+	fake.ttl = 1
+	ts := httptest.NewServer(fake)
+	defer ts.Close()
+
+	s := configstore.NewStore()
+	defer s.Close()
+	ch := s.Watch()
+	cfg := Config{Address: ts.URL, RoleID: "myapp", SecretID: "s3cr3t", Interval: 50 * time.Millisecond, RetryDelay: 10 * time.Millisecond}
+	require.NoError(t, Register(s, "secret/myapp/db", cfg))
+	storetest.WaitNotification(t, ch)
+
+	// the secret is re-read at the given interval
+	fake.setSecret(map[string]any{"password": "correct horse"})
+	storetest.WaitNotification(t, ch)
+	v, err := s.GetItemValue("password")
+	require.NoError(t, err)
+	assert.Equal(t, "correct horse", v)
+
+	// the token gets renewed before it expires
+	assert.Eventually(t, func() bool {
+		fake.mut.Lock()
+		defer fake.mut.Unlock()
+		return fake.renewals > 0
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// a revoked token triggers a new login
+	fake.mut.Lock()
+	logins := fake.logins
+	fake.mut.Unlock()
+	fake.revoke("approle-" + strconv.Itoa(logins))
+	fake.setSecret(map[string]any{"password": "battery staple"})
+	storetest.WaitNotification(t, ch)
+	v, err = s.GetItemValue("password")
+	require.NoError(t, err)
+	assert.Equal(t, "battery staple", v)
+	fake.mut.Lock()
+	assert.Greater(t, fake.logins, logins)
+	fake.mut.Unlock()
+}
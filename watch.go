@@ -0,0 +1,136 @@
+package configstore
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"hash"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// DefaultPollInterval is the interval used by polling providers when none is specified.
+var DefaultPollInterval = 10 * time.Second
+
+// watchFile calls onChange every time the file is written to.
+func watchFile(s *Store, filename string, onChange func()) error {
+	return watchPath(s, filename, fsnotify.Write, onChange)
+}
+
+// watchDir calls onChange every time a file is created, renamed or removed in the directory.
+func watchDir(s *Store, dirname string, onChange func()) error {
+	return watchPath(s, dirname, fsnotify.Create|fsnotify.Rename|fsnotify.Remove, onChange)
+}
+
+// watchPath calls onChange every time one of the given operations happens on path.
+func watchPath(s *Store, path string, ops fsnotify.Op, onChange func()) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+
+	if err := watcher.Add(path); err != nil {
+		_ = watcher.Close()
+		return err
+	}
+
+	go func() {
+		defer func(w *fsnotify.Watcher) {
+			_ = w.Close()
+		}(watcher)
+
+		for {
+			select {
+			case <-s.ctx.Done():
+				return
+
+			case event, ok := <-watcher.Events:
+				if !ok {
+					continue
+				}
+
+				if event.Op&ops != 0 {
+					onChange()
+				}
+
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					continue
+				}
+				logError(err)
+			}
+		}
+	}()
+
+	return nil
+}
+
+// pollPath calls onChange every time the stat or content of path changes.
+// Directories are browsed recursively, following symbolic links.
+// This works on filesystems where notifications are not available (NFS, some FUSE mounts, ...).
+func pollPath(s *Store, path string, interval time.Duration, onChange func()) {
+	if interval <= 0 {
+		interval = DefaultPollInterval
+	}
+
+	prev := pathSignature(path)
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-s.ctx.Done():
+				return
+
+			case <-ticker.C:
+				sig := pathSignature(path)
+				if sig != prev {
+					prev = sig
+					onChange()
+				}
+			}
+		}
+	}()
+}
+
+// pathSignature hashes the name, size, modification time and content of all the files found under path.
+// Errors (such as a missing file) are part of the signature, so that their resolution is detected as a change.
+func pathSignature(path string) [sha256.Size]byte {
+	h := sha256.New()
+	hashPath(h, path)
+	var sum [sha256.Size]byte
+	copy(sum[:], h.Sum(nil))
+	return sum
+}
+
+func hashPath(h hash.Hash, path string) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		fmt.Fprintf(h, "%s: %v\n", path, err)
+		return
+	}
+
+	if fi.IsDir() {
+		files, err := os.ReadDir(path)
+		if err != nil {
+			fmt.Fprintf(h, "%s: %v\n", path, err)
+			return
+		}
+		for _, f := range files {
+			hashPath(h, filepath.Join(path, f.Name()))
+		}
+		return
+	}
+
+	fmt.Fprintf(h, "%s %d %d\n", path, fi.Size(), fi.ModTime().UnixNano())
+	content, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Fprintf(h, "%s: %v\n", path, err)
+		return
+	}
+	h.Write(content)
+}
@@ -0,0 +1,93 @@
+package configstore
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ovh/configstore/internal/storetest"
+)
+
+func TestFilePoll(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "test.yaml")
+	require.NoError(t, os.WriteFile(filename, []byte("- key: foo\n  value: bar\n"), 0o600))
+
+	s := NewStore()
+	defer s.Close()
+	s.FilePoll(filename, 10*time.Millisecond)
+	ch := s.Watch()
+
+	v, err := s.GetItemValue("foo")
+	require.NoError(t, err)
+	assert.Equal(t, "bar", v)
+
+	require.NoError(t, os.WriteFile(filename, []byte("- key: foo\n  value: baz\n"), 0o600))
+	storetest.WaitNotification(t, ch)
+
+	v, err = s.GetItemValue("foo")
+	require.NoError(t, err)
+	assert.Equal(t, "baz", v)
+}
+
+func TestFileTreePoll(t *testing.T) {
+	dirname := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dirname, "foo"), []byte("bar"), 0o600))
+
+	s := NewStore()
+	defer s.Close()
+	s.FileTreePoll(dirname, 10*time.Millisecond)
+	ch := s.Watch()
+
+	require.NoError(t, os.Mkdir(filepath.Join(dirname, "sub"), 0o700))
+	require.NoError(t, os.WriteFile(filepath.Join(dirname, "sub", "baz"), []byte("buz"), 0o600))
+	storetest.WaitNotification(t, ch)
+
+	require.Eventually(t, func() bool {
+		v, err := s.GetItemValue("sub/baz")
+		return err == nil && v == "buz"
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestFileListPollRemove(t *testing.T) {
+	dirname := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dirname, "a.yaml"), []byte("- key: a\n  value: a\n"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dirname, "b.yaml"), []byte("- key: b\n  value: b\n"), 0o600))
+
+	s := NewStore()
+	defer s.Close()
+	s.FileListPoll(dirname, 10*time.Millisecond)
+	ch := s.Watch()
+
+	require.NoError(t, os.Remove(filepath.Join(dirname, "a.yaml")))
+	storetest.WaitNotification(t, ch)
+
+	_, err := s.GetItemValue("a")
+	assert.ErrorIs(t, err, ErrNotFound)
+	v, err := s.GetItemValue("b")
+	require.NoError(t, err)
+	assert.Equal(t, "b", v)
+}
+
+func TestFileTreePollRecover(t *testing.T) {
+	dirname := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dirname, "foo"), []byte("bar"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dirname, FileTreeDirMetaFile), []byte("priority: [\n"), 0o600))
+
+	s := NewStore()
+	defer s.Close()
+	s.FileTreePoll(dirname, 10*time.Millisecond)
+	ch := s.Watch()
+	_, err := s.GetItemList()
+	require.Error(t, err)
+
+	// the provider recovers once the metadata is fixed
+	require.NoError(t, os.WriteFile(filepath.Join(dirname, FileTreeDirMetaFile), []byte("priority: 20\n"), 0o600))
+	storetest.WaitNotification(t, ch)
+	i, err := s.GetItem("foo")
+	require.NoError(t, err)
+	assert.Equal(t, int64(20), i.Priority())
+}